@@ -1,50 +1,61 @@
 package main
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
-	"strings"
+	"strconv"
 	"syscall"
+	"time"
 
+	"github.com/DimRev/httpfromtcp/internal/headers"
+	"github.com/DimRev/httpfromtcp/internal/middleware"
 	"github.com/DimRev/httpfromtcp/internal/request"
 	"github.com/DimRev/httpfromtcp/internal/response"
+	"github.com/DimRev/httpfromtcp/internal/router"
 	"github.com/DimRev/httpfromtcp/internal/server"
 )
 
-const PORT = 42069
+const ADDR = ":42069"
+const SHUTDOWN_TIMEOUT = 10 * time.Second
 
 func main() {
-	server, err := server.Serve(PORT, handler)
+	r := router.New()
+	r.Any("/httpbin/{path...}", proxyHandler)
+	r.Any("/yourproblem", handler400)
+	r.Any("/myproblem", handler500)
+	r.Any("/{path...}", handler200)
+
+	handler := server.Chain(
+		middleware.Logging,
+		middleware.Recovery,
+		middleware.RequestID,
+		middleware.Timing,
+	)(r.Serve)
+
+	server, err := server.Serve(ADDR, handler)
 	if err != nil {
 		log.Fatalf("Error starting server: %v", err)
 	}
-	defer server.Close()
-	log.Println("Server started on port", PORT)
+	log.Println("Server started on", server.Addr())
 
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 	<-sigChan
-	log.Println("Server gracefully stopped")
-}
 
-func handler(w *response.Writer, req *request.Request) {
-	if strings.HasPrefix(req.RequestLine.RequestTarget, "/httpbin") {
-		proxyHandler(w, req)
-		return
-	}
-	if req.RequestLine.RequestTarget == "/yourproblem" {
-		handler400(w, req)
+	ctx, cancel := context.WithTimeout(context.Background(), SHUTDOWN_TIMEOUT)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("Error shutting down server: %v", err)
 		return
 	}
-	if req.RequestLine.RequestTarget == "/myproblem" {
-		handler500(w, req)
-		return
-	}
-	handler200(w, req)
+	log.Println("Server gracefully stopped")
 }
 
 func handler500(w *response.Writer, req *request.Request) {
@@ -57,11 +68,7 @@ func handler500(w *response.Writer, req *request.Request) {
     <p>Okay, you know what? This one is on me.</p>
   </body>
 </html>`
-	h := response.GetDefaultHeaders(len(html))
-	h.Replace("Content-Type", "text/html")
-	w.WriteStatusLine(response.StatusInternalServerError)
-	w.WriteHeaders(h)
-	w.WriteBody([]byte(html))
+	writeHTML(w, response.StatusInternalServerError, html)
 }
 
 func handler400(w *response.Writer, req *request.Request) {
@@ -74,11 +81,7 @@ func handler400(w *response.Writer, req *request.Request) {
 		<p>Your request honestly kinda sucked.</p>
 	</body>
 </html>`
-	h := response.GetDefaultHeaders(len(html))
-	h.Replace("Content-Type", "text/html")
-	w.WriteStatusLine(response.StatusBadRequest)
-	w.WriteHeaders(h)
-	w.WriteBody([]byte(html))
+	writeHTML(w, response.StatusBadRequest, html)
 }
 
 func handler200(w *response.Writer, req *request.Request) {
@@ -91,52 +94,73 @@ func handler200(w *response.Writer, req *request.Request) {
     <p>Your request was an absolute banger.</p>
   </body>
 </html>`
-	h := response.GetDefaultHeaders(len(html))
-	h.Replace("Content-Type", "text/html")
-	w.WriteStatusLine(response.StatusOK)
-	w.WriteHeaders(h)
-	w.WriteBody([]byte(html))
+	writeHTML(w, response.StatusOK, html)
+}
+
+func writeHTML(w *response.Writer, statusCode response.StatusCode, html string) {
+	w.WriteStatusLine(statusCode)
+	w.Header().Set("Content-Type", "text/html")
+	io.WriteString(w, html)
 }
 
 func proxyHandler(w *response.Writer, req *request.Request) {
-	target := strings.TrimPrefix(req.RequestLine.RequestTarget, "/httpbin/")
-	url := "https://httpbin.org/" + target
+	url := "https://httpbin.org/" + req.PathValue("path")
+	if req.Target.RawQuery != "" {
+		url += "?" + req.Target.RawQuery
+	}
 	fmt.Println("Proxying to", url)
-	resp, err := http.Get(url)
+	proxyReq, err := http.NewRequestWithContext(req.Context(), http.MethodGet, url, nil)
+	if err != nil {
+		handler500(w, req)
+		return
+	}
+	resp, err := http.DefaultClient.Do(proxyReq)
 	if err != nil {
 		handler500(w, req)
 		return
 	}
 	defer resp.Body.Close()
 
-	w.WriteStatusLine(response.StatusOK)
+	w.WriteStatusLine(response.StatusCode(resp.StatusCode))
 	h := response.GetDefaultHeaders(0)
-	h.Replace("Transfer-Encoding", "chunked")
-	h.Delete("Content-Length")
+	h.Set("Transfer-Encoding", "chunked")
+	h.Set("Trailer", "X-Content-SHA256, X-Content-Length")
+	h.Del("Content-Length")
 	w.WriteHeaders(h)
+
+	hash := sha256.New()
+	length := 0
 	const maxChunkSize = 1024
 	buffer := make([]byte, maxChunkSize)
 	for {
 		n, err := resp.Body.Read(buffer)
 		fmt.Println("Read", n, "bytes")
 		if n > 0 {
-			_, err = w.WriteChunkedBody(buffer[:n])
-			if err != nil {
+			hash.Write(buffer[:n])
+			length += n
+			if _, err := w.WriteChunkedBody(buffer[:n]); err != nil {
 				log.Printf("Error writing chunked body: %v", err)
-				break
+				w.Abort()
+				return
 			}
 		}
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
+			// Trailers over a truncated body would vouch for it, so the
+			// response is left unterminated instead.
 			fmt.Println("Error reading response body:", err)
-			break
+			w.Abort()
+			return
 		}
 	}
-	_, err = w.WriteChunkedBodyDone()
-	if err != nil {
-		log.Printf("Error writing chunked body done: %v", err)
+
+	trailers := headers.NewHeaders()
+	trailers.Set("X-Content-SHA256", hex.EncodeToString(hash.Sum(nil)))
+	trailers.Set("X-Content-Length", strconv.Itoa(length))
+	if err := w.WriteTrailers(trailers); err != nil {
+		log.Printf("Error writing trailers: %v", err)
 		return
 	}
 }
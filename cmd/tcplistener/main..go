@@ -36,7 +36,7 @@ func handleConnection(conn net.Conn) {
 	}
 
 	formattedHeaders := ""
-	for key, value := range req.Headers {
+	for key, value := range req.Headers.All() {
 		formattedHeaders += fmt.Sprintf("- %s: %s\n", key, value)
 	}
 
@@ -1,5 +1,7 @@
 package headers
 
+import "fmt"
+
 type ErrorParsingHeaderMalformed struct {
 	Line string
 }
@@ -39,3 +41,19 @@ type ErrorParsingHeaderEmptyKey struct {
 func (e *ErrorParsingHeaderEmptyKey) Error() string {
 	return "error: empty key in header line: " + e.Line
 }
+
+type ErrorParsingHeaderInvalidValue struct {
+	Line string
+}
+
+func (e *ErrorParsingHeaderInvalidValue) Error() string {
+	return fmt.Sprintf("error: invalid characters in value in header line: %q", e.Line)
+}
+
+type ErrorParsingHeaderObsFold struct {
+	Line string
+}
+
+func (e *ErrorParsingHeaderObsFold) Error() string {
+	return "error: obsolete line folding in header line: " + e.Line
+}
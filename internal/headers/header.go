@@ -3,10 +3,24 @@ package headers
 import (
 	"bytes"
 	"fmt"
+	"io"
+	"iter"
+	"slices"
 	"strings"
 )
 
-type Headers map[string]string
+// Headers is an ordered list of header fields. Field names keep the casing
+// they were added with but are matched case-insensitively, and a field may
+// repeat, as Set-Cookie must. Fields are written in the order they were
+// added.
+type Headers struct {
+	fields []field
+}
+
+type field struct {
+	name  string
+	value string
+}
 
 var validKeyChars = map[rune]bool{
 	'a': true, 'b': true, 'c': true, 'd': true, 'e': true,
@@ -33,11 +47,34 @@ var validKeyChars = map[rune]bool{
 
 const CRLF = "\r\n"
 
-func NewHeaders() Headers {
-	return Headers{}
+func NewHeaders() *Headers {
+	return &Headers{}
+}
+
+// ObsFold selects how Parse treats obsolete line folding: a line starting
+// with a space or tab that continues the previous field's value.
+type ObsFold int
+
+const (
+	// ObsFoldReject fails parsing with ErrorParsingHeaderObsFold.
+	ObsFoldReject ObsFold = iota
+	// ObsFoldReplace joins the continuation onto the previous value with a
+	// single space, as RFC 9112 allows a server to do.
+	ObsFoldReplace
+)
+
+type ParseOptions struct {
+	ObsFold ObsFold
 }
 
-func (h Headers) Parse(data []byte) (n int, done bool, err error) {
+// Parse parses header lines from data with the default ParseOptions.
+func (h *Headers) Parse(data []byte) (n int, done bool, err error) {
+	return h.ParseWithOptions(data, ParseOptions{})
+}
+
+// ParseWithOptions parses complete header lines from data, returning the
+// bytes consumed and whether the blank line ending the section was reached.
+func (h *Headers) ParseWithOptions(data []byte, opts ParseOptions) (n int, done bool, err error) {
 	totalBytesParsed := 0
 	for {
 		idx := bytes.Index(data, []byte(CRLF))
@@ -45,20 +82,21 @@ func (h Headers) Parse(data []byte) (n int, done bool, err error) {
 			return totalBytesParsed, false, nil
 		}
 
-		if idx == 0 || strings.TrimSpace(string(data[:idx])) == "" {
+		if idx == 0 {
 			return totalBytesParsed + len(CRLF), true, nil
 		}
 
-		key, value, err := validateHeader(string(data[:idx]))
-		if err != nil {
-			return 0, false, err
-		}
-
-		curr, exists := h[strings.ToLower(key)]
-		if exists {
-			h[strings.ToLower(key)] = fmt.Sprintf("%s, %s", curr, value)
+		line := string(data[:idx])
+		if isOWS(line[0]) && h.Len() > 0 {
+			if err := h.unfold(line, opts.ObsFold); err != nil {
+				return 0, false, err
+			}
 		} else {
-			h[strings.ToLower(key)] = value
+			key, value, err := validateHeader(line)
+			if err != nil {
+				return 0, false, err
+			}
+			h.Add(key, value)
 		}
 
 		totalBytesParsed += idx + len(CRLF)
@@ -66,51 +104,191 @@ func (h Headers) Parse(data []byte) (n int, done bool, err error) {
 	}
 }
 
-func (h Headers) Get(key string) string {
-	val, exists := h[strings.ToLower(key)]
-	if !exists {
-		return ""
+// Get returns the first value of key, or "" if it is not present. Use
+// Values for fields that may repeat.
+func (h *Headers) Get(key string) string {
+	for _, f := range h.fields {
+		if strings.EqualFold(f.name, key) {
+			return f.value
+		}
 	}
-	return val
+	return ""
 }
 
-func (h Headers) Set(key, value string) {
-	curr, exists := h[strings.ToLower(key)]
-	if exists {
-		h[strings.ToLower(key)] = fmt.Sprintf("%s, %s", curr, value)
-	} else {
-		h[strings.ToLower(key)] = value
+// Values returns every value of key in the order they were added.
+func (h *Headers) Values(key string) []string {
+	var values []string
+	for _, f := range h.fields {
+		if strings.EqualFold(f.name, key) {
+			values = append(values, f.value)
+		}
 	}
+	return values
 }
 
-func (h Headers) Replace(key, value string) {
-	h[strings.ToLower(key)] = value
+// Has reports whether key is present, even with an empty value.
+func (h *Headers) Has(key string) bool {
+	for _, f := range h.fields {
+		if strings.EqualFold(f.name, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// Add appends a value for key, keeping any existing ones.
+func (h *Headers) Add(key, value string) {
+	h.fields = append(h.fields, field{name: key, value: value})
+}
+
+// Set replaces every value of key with value. The field keeps the position
+// of its first occurrence, or is appended if it was not present.
+func (h *Headers) Set(key, value string) {
+	replaced := false
+	fields := h.fields[:0]
+	for _, f := range h.fields {
+		if !strings.EqualFold(f.name, key) {
+			fields = append(fields, f)
+			continue
+		}
+		if !replaced {
+			fields = append(fields, field{name: key, value: value})
+			replaced = true
+		}
+	}
+	h.fields = fields
+	if !replaced {
+		h.Add(key, value)
+	}
+}
+
+// Del removes every value of key.
+func (h *Headers) Del(key string) {
+	h.fields = slices.DeleteFunc(h.fields, func(f field) bool {
+		return strings.EqualFold(f.name, key)
+	})
 }
 
-func (h Headers) Delete(key string) {
-	delete(h, strings.ToLower(key))
+// Len returns the number of fields, counting each repeat.
+func (h *Headers) Len() int {
+	return len(h.fields)
+}
+
+// All iterates over every field in order.
+func (h *Headers) All() iter.Seq2[string, string] {
+	return func(yield func(string, string) bool) {
+		for _, f := range h.fields {
+			if !yield(f.name, f.value) {
+				return
+			}
+		}
+	}
 }
 
+// WriteTo writes each field as a "Name: value" line in order, without the
+// blank line that ends a header section.
+func (h *Headers) WriteTo(w io.Writer) (int64, error) {
+	var total int64
+	for _, f := range h.fields {
+		n, err := fmt.Fprintf(w, "%s: %s\r\n", f.name, f.value)
+		total += int64(n)
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// ContainsToken reports whether the comma-separated values of key contain
+// token, compared case-insensitively.
+func (h *Headers) ContainsToken(key, token string) bool {
+	for _, value := range h.Values(key) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// unfold applies mode to an obs-fold continuation line of the last field.
+func (h *Headers) unfold(line string, mode ObsFold) error {
+	if mode != ObsFoldReplace {
+		return &ErrorParsingHeaderObsFold{Line: line}
+	}
+	value := trimOWS(line)
+	if !isValidFieldValue(value) {
+		return &ErrorParsingHeaderInvalidValue{Line: line}
+	}
+	last := &h.fields[len(h.fields)-1]
+	if value == "" {
+		return nil
+	}
+	if last.value == "" {
+		last.value = value
+	} else {
+		last.value += " " + value
+	}
+	return nil
+}
+
+// validateHeader splits a field line at its first colon. No whitespace may
+// precede the colon, while whitespace around the value is dropped.
 func validateHeader(line string) (key, value string, err error) {
-	parts := strings.Split(line, ": ")
-	if len(parts) != 2 {
+	key, value, found := strings.Cut(line, ":")
+	if !found {
 		return "", "", &ErrorParsingHeaderKeyValuePairMissing{Line: line}
 	}
-	if strings.HasSuffix(parts[0], " ") {
+	if key != "" && isOWS(key[len(key)-1]) {
 		return "", "", &ErrorParsingHeaderTrailingSpaceInKey{Line: line}
 	}
-	key = strings.TrimSpace(parts[0])
 	if len(key) == 0 {
 		return "", "", &ErrorParsingHeaderEmptyKey{Line: line}
 	}
+	// A name cannot contain whitespace, so the colon found belongs to a
+	// value and the line has none of its own, as in "Host localhost:80".
+	if strings.ContainsAny(key, " \t") {
+		return "", "", &ErrorParsingHeaderKeyValuePairMissing{Line: line}
+	}
 	if !isValidHeaderKey(key) {
 		return "", "", &ErrorParsingHeaderMalformedKey{Line: line}
 	}
 
-	value = strings.TrimSpace(parts[1])
+	value = trimOWS(value)
+	if !isValidFieldValue(value) {
+		return "", "", &ErrorParsingHeaderInvalidValue{Line: line}
+	}
 	return key, value, nil
 }
 
+// isValidFieldValue reports whether value holds only visible characters,
+// obs-text, and spaces or tabs between them, as RFC 9110 field values must.
+// Control characters such as NUL and a bare CR are rejected.
+func isValidFieldValue(value string) bool {
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c < ' ' && c != '\t' || c == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+func isOWS(c byte) bool {
+	return c == ' ' || c == '\t'
+}
+
+func trimOWS(s string) string {
+	return strings.Trim(s, " \t")
+}
+
+// IsToken reports whether s is a non-empty RFC 9110 token, the syntax shared
+// by field names and request methods.
+func IsToken(s string) bool {
+	return s != "" && isValidHeaderKey(s)
+}
+
 func isValidHeaderKey(key string) bool {
 	for _, c := range key {
 		if !validKeyChars[c] {
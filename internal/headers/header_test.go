@@ -1,6 +1,7 @@
 package headers
 
 import (
+	"bytes"
 	"errors"
 	"testing"
 
@@ -16,7 +17,7 @@ func TestHeaderParse(t *testing.T) {
 		n, done, err := headers.Parse(data)
 		require.NoError(t, err)
 		require.NotNil(t, headers)
-		assert.Equal(t, "localhost:42069", headers["host"])
+		assert.Equal(t, "localhost:42069", headers.Get("host"))
 		assert.Equal(t, len("Host: localhost:42069\r\n"), n)
 		assert.False(t, done) // Not done yet, more headers may follow
 	})
@@ -26,7 +27,7 @@ func TestHeaderParse(t *testing.T) {
 		data := []byte("Host: localhost:42069   \r\n")
 		n, done, err := headers.Parse(data)
 		require.NoError(t, err)
-		assert.Equal(t, "localhost:42069", headers["host"])
+		assert.Equal(t, "localhost:42069", headers.Get("host"))
 		assert.Equal(t, len("Host: localhost:42069   \r\n"), n)
 		assert.False(t, done) // Not done yet, more headers may follow
 	})
@@ -36,8 +37,8 @@ func TestHeaderParse(t *testing.T) {
 		data := []byte("Host: localhost:42069\r\nUser-Agent: curl/7.81.0\r\n\r\n")
 		n, done, err := headers.Parse(data)
 		require.NoError(t, err)
-		assert.Equal(t, "localhost:42069", headers["host"])
-		assert.Equal(t, "curl/7.81.0", headers["user-agent"])
+		assert.Equal(t, "localhost:42069", headers.Get("host"))
+		assert.Equal(t, "curl/7.81.0", headers.Get("user-agent"))
 		assert.Equal(t, len("Host: localhost:42069\r\nUser-Agent: curl/7.81.0\r\n\r\n"), n)
 		assert.True(t, done) // Indicates end of headers
 	})
@@ -117,9 +118,25 @@ func TestHeaderParse(t *testing.T) {
 		headers := NewHeaders()
 		data := []byte("   \r\n")
 		n, done, err := headers.Parse(data)
+		var target *ErrorParsingHeaderKeyValuePairMissing
+		require.ErrorAs(t, err, &target)
+		assert.Equal(t, 0, n)
+		assert.False(t, done)
+	})
+
+	t.Run("whitespace line after a header", func(t *testing.T) {
+		data := []byte("X-A: b\r\n \r\nContent-Length: 5\r\n\r\n")
+		_, _, err := NewHeaders().Parse(data)
+		var target *ErrorParsingHeaderObsFold
+		require.ErrorAs(t, err, &target)
+
+		headers := NewHeaders()
+		n, done, err := headers.ParseWithOptions(data, ParseOptions{ObsFold: ObsFoldReplace})
 		require.NoError(t, err)
-		assert.Equal(t, 2, n) // Length of CRLF
-		assert.True(t, done)  // Indicates end of headers
+		assert.Equal(t, len(data), n)
+		assert.True(t, done)
+		assert.Equal(t, "b", headers.Get("X-A"))
+		assert.Equal(t, "5", headers.Get("Content-Length"))
 	})
 
 	t.Run("header with trailing whitespace in value", func(t *testing.T) {
@@ -127,7 +144,7 @@ func TestHeaderParse(t *testing.T) {
 		data := []byte("Host: localhost:42069   \r\n")
 		n, done, err := headers.Parse(data)
 		require.NoError(t, err)
-		assert.Equal(t, "localhost:42069", headers["host"])
+		assert.Equal(t, "localhost:42069", headers.Get("host"))
 		assert.Equal(t, len("Host: localhost:42069   \r\n"), n)
 		assert.False(t, done) // Not done yet, more headers may follow
 	})
@@ -138,9 +155,147 @@ func TestHeaderParse(t *testing.T) {
 		data := []byte("Host: localhost:42069\r\nHost: localhost:69420\r\na: 1\r\na: 2\r\na: 3\r\n")
 		n, done, err := headers.Parse(data)
 		require.NoError(t, err)
-		assert.Equal(t, "localhost:42069, localhost:69420", headers["host"])
-		assert.Equal(t, "1, 2, 3", headers["a"])
+		assert.Equal(t, []string{"localhost:42069", "localhost:69420"}, headers.Values("host"))
+		assert.Equal(t, []string{"1", "2", "3"}, headers.Values("a"))
+		assert.Equal(t, "localhost:42069", headers.Get("host"))
 		assert.Equal(t, len("Host: localhost:42069\r\nHost: localhost:69420\r\na: 1\r\na: 2\r\na: 3\r\n"), n)
 		assert.False(t, done) // Not done yet, more headers may follow
 	})
 }
+
+func TestHeaderContainsToken(t *testing.T) {
+	headers := NewHeaders()
+	headers.Set("Connection", "keep-alive")
+	headers.Add("Connection", "Upgrade")
+
+	assert.True(t, headers.ContainsToken("connection", "keep-alive"))
+	assert.True(t, headers.ContainsToken("Connection", "upgrade"))
+	assert.False(t, headers.ContainsToken("connection", "close"))
+	assert.False(t, headers.ContainsToken("transfer-encoding", "chunked"))
+}
+
+func TestHeaderFields(t *testing.T) {
+	t.Run("add keeps repeated values apart", func(t *testing.T) {
+		headers := NewHeaders()
+		headers.Add("Set-Cookie", "a=1; Path=/")
+		headers.Add("set-cookie", "b=2, c=3")
+		assert.Equal(t, []string{"a=1; Path=/", "b=2, c=3"}, headers.Values("SET-COOKIE"))
+		assert.Equal(t, 2, headers.Len())
+	})
+
+	t.Run("set replaces in place", func(t *testing.T) {
+		headers := NewHeaders()
+		headers.Add("Vary", "Accept")
+		headers.Add("Content-Type", "text/plain")
+		headers.Add("vary", "Origin")
+		headers.Set("VARY", "*")
+		headers.Set("Cache-Control", "no-store")
+
+		var buf bytes.Buffer
+		_, err := headers.WriteTo(&buf)
+		require.NoError(t, err)
+		assert.Equal(t, "VARY: *\r\nContent-Type: text/plain\r\nCache-Control: no-store\r\n", buf.String())
+	})
+
+	t.Run("del removes every value", func(t *testing.T) {
+		headers := NewHeaders()
+		headers.Add("A", "1")
+		headers.Add("B", "2")
+		headers.Add("a", "3")
+		headers.Del("a")
+		assert.False(t, headers.Has("A"))
+		assert.Nil(t, headers.Values("A"))
+		assert.Equal(t, "", headers.Get("A"))
+		assert.Equal(t, 1, headers.Len())
+	})
+
+	t.Run("parsing keeps order and casing", func(t *testing.T) {
+		headers := NewHeaders()
+		data := []byte("X-Zeta: 1\r\nhost: localhost\r\nX-Alpha: 2\r\n\r\n")
+		_, done, err := headers.Parse(data)
+		require.NoError(t, err)
+		require.True(t, done)
+
+		var names []string
+		for name := range headers.All() {
+			names = append(names, name)
+		}
+		assert.Equal(t, []string{"X-Zeta", "host", "X-Alpha"}, names)
+	})
+}
+
+func TestHeaderValues(t *testing.T) {
+	t.Run("colon splitting", func(t *testing.T) {
+		headers := NewHeaders()
+		data := []byte("Host:localhost:42069\r\nX-Note: a: b\r\nX-Tab:\tvalue\t \r\nX-Empty:\r\n\r\n")
+		_, done, err := headers.Parse(data)
+		require.NoError(t, err)
+		require.True(t, done)
+		assert.Equal(t, "localhost:42069", headers.Get("host"))
+		assert.Equal(t, "a: b", headers.Get("x-note"))
+		assert.Equal(t, "value", headers.Get("x-tab"))
+		assert.True(t, headers.Has("x-empty"))
+		assert.Equal(t, "", headers.Get("x-empty"))
+	})
+
+	t.Run("interior whitespace and obs-text", func(t *testing.T) {
+		headers := NewHeaders()
+		_, _, err := headers.Parse([]byte("X-Text: caf\xc3\xa9 au\tlait\r\n"))
+		require.NoError(t, err)
+		assert.Equal(t, "caf\xc3\xa9 au\tlait", headers.Get("x-text"))
+	})
+
+	t.Run("invalid characters", func(t *testing.T) {
+		for _, line := range []string{
+			"X-Bad: a\x00b\r\n",
+			"X-Bad: a\rb\r\n",
+			"X-Bad: a\x01b\r\n",
+			"X-Bad: a\x7fb\r\n",
+		} {
+			headers := NewHeaders()
+			n, done, err := headers.Parse([]byte(line))
+			var target *ErrorParsingHeaderInvalidValue
+			require.ErrorAs(t, err, &target, "%q", line)
+			assert.Equal(t, 0, n)
+			assert.False(t, done)
+		}
+	})
+
+	t.Run("obs-fold rejected by default", func(t *testing.T) {
+		headers := NewHeaders()
+		n, _, err := headers.Parse([]byte("X-Long: first\r\n second\r\n\r\n"))
+		var target *ErrorParsingHeaderObsFold
+		require.ErrorAs(t, err, &target)
+		assert.Equal(t, 0, n)
+	})
+
+	t.Run("obs-fold replaced with a space", func(t *testing.T) {
+		headers := NewHeaders()
+		opts := ParseOptions{ObsFold: ObsFoldReplace}
+		data := []byte("X-Long: first\r\n  second\r\n\tthird\r\nHost: localhost\r\n\r\n")
+		n, done, err := headers.ParseWithOptions(data, opts)
+		require.NoError(t, err)
+		assert.True(t, done)
+		assert.Equal(t, len(data), n)
+		assert.Equal(t, "first second third", headers.Get("x-long"))
+		assert.Equal(t, "localhost", headers.Get("host"))
+	})
+
+	t.Run("obs-fold split across reads", func(t *testing.T) {
+		headers := NewHeaders()
+		opts := ParseOptions{ObsFold: ObsFoldReplace}
+		_, _, err := headers.ParseWithOptions([]byte("X-Long: first\r\n"), opts)
+		require.NoError(t, err)
+		_, _, err = headers.ParseWithOptions([]byte(" second\r\n"), opts)
+		require.NoError(t, err)
+		assert.Equal(t, "first second", headers.Get("x-long"))
+	})
+
+	t.Run("obs-fold continuation must be a valid value", func(t *testing.T) {
+		headers := NewHeaders()
+		opts := ParseOptions{ObsFold: ObsFoldReplace}
+		_, _, err := headers.ParseWithOptions([]byte("X-Long: first\r\n bad\x00\r\n"), opts)
+		var target *ErrorParsingHeaderInvalidValue
+		assert.ErrorAs(t, err, &target)
+	})
+}
@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/DimRev/httpfromtcp/internal/headers"
+	"github.com/DimRev/httpfromtcp/internal/request"
+	"github.com/DimRev/httpfromtcp/internal/response"
+	"github.com/DimRev/httpfromtcp/internal/server"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+// Logging logs the method, target, status and duration of every request.
+// A response written with Write is finished first so its status is known.
+func Logging(next server.Handler) server.Handler {
+	return func(w *response.Writer, req *request.Request) {
+		start := time.Now()
+		next(w, req)
+		if err := w.Finish(); err != nil {
+			log.Printf("Error finishing response: %v", err)
+		}
+		log.Printf("%s %s %d %s",
+			req.RequestLine.Method,
+			req.RequestLine.RequestTarget,
+			w.StatusCode(),
+			time.Since(start),
+		)
+	}
+}
+
+// Recovery handles a panic in next with server.HandlePanic, so middlewares
+// wrapping it, such as Logging, still see the response it produces.
+func Recovery(next server.Handler) server.Handler {
+	return func(w *response.Writer, req *request.Request) {
+		defer func() {
+			if rec := recover(); rec != nil {
+				server.HandlePanic(w, req, rec)
+			}
+		}()
+		next(w, req)
+	}
+}
+
+type requestIDKey struct{}
+
+// RequestIDFromContext returns the ID RequestID attached to a request's
+// context, or "" if there is none.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// RequestID makes sure every request carries an X-Request-ID, generating
+// one when the client did not send it, stores it on the request context
+// and echoes it on the response.
+func RequestID(next server.Handler) server.Handler {
+	return func(w *response.Writer, req *request.Request) {
+		id := req.Headers.Get(RequestIDHeader)
+		if id == "" {
+			id = newRequestID()
+			req.Headers.Set(RequestIDHeader, id)
+		}
+		req = req.WithContext(context.WithValue(req.Context(), requestIDKey{}, id))
+		w.OnWriteHeaders(func(h *headers.Headers) {
+			if h.Get(RequestIDHeader) == "" {
+				h.Set(RequestIDHeader, id)
+			}
+		})
+		next(w, req)
+	}
+}
+
+// Timing reports how long the handler took to produce its headers in a
+// Server-Timing field.
+func Timing(next server.Handler) server.Handler {
+	return func(w *response.Writer, req *request.Request) {
+		start := time.Now()
+		w.OnWriteHeaders(func(h *headers.Headers) {
+			elapsed := float64(time.Since(start).Microseconds()) / 1000
+			h.Set("Server-Timing", fmt.Sprintf("app;dur=%.3f", elapsed))
+		})
+		next(w, req)
+	}
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
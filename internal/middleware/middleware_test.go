@@ -0,0 +1,150 @@
+package middleware
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/DimRev/httpfromtcp/internal/request"
+	"github.com/DimRev/httpfromtcp/internal/response"
+	"github.com/DimRev/httpfromtcp/internal/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRequest(t *testing.T, headers ...string) *request.Request {
+	t.Helper()
+	raw := "GET / HTTP/1.1\r\n" + strings.Join(append(headers, ""), "\r\n") + "\r\n"
+	req, err := request.RequestFromReader(strings.NewReader(raw))
+	require.NoError(t, err)
+	return req
+}
+
+func ok(w *response.Writer, req *request.Request) {
+	w.WriteStatusLine(response.StatusOK)
+	w.WriteHeaders(response.GetDefaultHeaders(2))
+	w.WriteBody([]byte("ok"))
+}
+
+func TestChain(t *testing.T) {
+	var order []string
+	trace := func(name string) server.Middleware {
+		return func(next server.Handler) server.Handler {
+			return func(w *response.Writer, req *request.Request) {
+				order = append(order, name+" before")
+				next(w, req)
+				order = append(order, name+" after")
+			}
+		}
+	}
+
+	handler := server.Chain(trace("a"), trace("b"))(func(w *response.Writer, req *request.Request) {
+		order = append(order, "handler")
+	})
+	handler(response.NewWriter(&bytes.Buffer{}), newRequest(t))
+
+	assert.Equal(t, []string{"a before", "b before", "handler", "b after", "a after"}, order)
+}
+
+func TestLogging(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	t.Run("buffered responses", func(t *testing.T) {
+		logs.Reset()
+		var buf bytes.Buffer
+		Logging(func(w *response.Writer, req *request.Request) {
+			w.Write([]byte("buffered"))
+		})(response.NewWriter(&buf), newRequest(t))
+
+		assert.Contains(t, logs.String(), "GET / 200 ")
+		assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\nbuffered"))
+	})
+
+	t.Run("recovered panics", func(t *testing.T) {
+		logs.Reset()
+		server.Chain(Logging, Recovery)(func(w *response.Writer, req *request.Request) {
+			panic("boom")
+		})(response.NewWriter(&bytes.Buffer{}), newRequest(t))
+
+		assert.Contains(t, logs.String(), "GET / 500 ")
+	})
+}
+
+func TestRecovery(t *testing.T) {
+	t.Run("panic before writing", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := response.NewWriter(&buf)
+		w.SetKeepAlive(true)
+		Recovery(func(w *response.Writer, req *request.Request) {
+			panic("boom")
+		})(w, newRequest(t))
+
+		assert.True(t, strings.HasPrefix(buf.String(), "HTTP/1.1 500 Internal Server Error"))
+		assert.Equal(t, response.StatusInternalServerError, w.StatusCode())
+	})
+
+	t.Run("panic mid-response", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := response.NewWriter(&buf)
+		w.SetKeepAlive(true)
+		Recovery(func(w *response.Writer, req *request.Request) {
+			w.WriteStatusLine(response.StatusOK)
+			panic("boom")
+		})(w, newRequest(t))
+
+		assert.Equal(t, "HTTP/1.1 200 OK\r\n", buf.String())
+		assert.False(t, w.KeepAlive())
+	})
+
+	t.Run("panic mid-body is not finished", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := response.NewWriter(&buf)
+		w.SetKeepAlive(true)
+		w.SetBufferSize(4)
+		Recovery(func(w *response.Writer, req *request.Request) {
+			w.Write([]byte("partial"))
+			panic("boom")
+		})(w, newRequest(t))
+		require.NoError(t, w.Finish())
+
+		assert.True(t, strings.HasSuffix(buf.String(), "7\r\npartial\r\n"))
+		assert.False(t, w.KeepAlive())
+	})
+}
+
+func TestRequestID(t *testing.T) {
+	t.Run("generated", func(t *testing.T) {
+		var buf bytes.Buffer
+		req := newRequest(t)
+		RequestID(ok)(response.NewWriter(&buf), req)
+
+		id := req.Headers.Get(RequestIDHeader)
+		assert.Len(t, id, 32)
+		assert.Contains(t, buf.String(), id)
+	})
+
+	t.Run("from client", func(t *testing.T) {
+		var buf bytes.Buffer
+		var fromContext string
+		req := newRequest(t, "X-Request-ID: abc123")
+		RequestID(func(w *response.Writer, req *request.Request) {
+			fromContext = RequestIDFromContext(req.Context())
+			ok(w, req)
+		})(response.NewWriter(&buf), req)
+
+		assert.Equal(t, "abc123", fromContext)
+
+		assert.Equal(t, "abc123", req.Headers.Get(RequestIDHeader))
+		assert.Contains(t, buf.String(), "abc123")
+	})
+}
+
+func TestTiming(t *testing.T) {
+	var buf bytes.Buffer
+	Timing(ok)(response.NewWriter(&buf), newRequest(t))
+	assert.Contains(t, strings.ToLower(buf.String()), "server-timing: app;dur=")
+}
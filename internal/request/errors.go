@@ -16,6 +16,10 @@ func (e *ErrorUnexpectedReadError) Error() string {
 	return fmt.Sprintf("error: reading request: %s", e.Err.Error())
 }
 
+func (e *ErrorUnexpectedReadError) Unwrap() error {
+	return e.Err
+}
+
 type ErrorParsingUnknownState struct {
 	State requestState
 }
@@ -62,6 +66,14 @@ func (e *ErrorParsingRequestInvalidVersion) Error() string {
 	return fmt.Sprintf("error: invalid version: %s", e.Version)
 }
 
+type ErrorParsingRequestUnsupportedVersion struct {
+	Version string
+}
+
+func (e *ErrorParsingRequestUnsupportedVersion) Error() string {
+	return fmt.Sprintf("error: unsupported version: %s", e.Version)
+}
+
 type ErrorParsingBodyInvalidContentLength struct {
 	ContentLength string
 }
@@ -79,3 +91,99 @@ type ErrorParsingBodyInvalidBodySize struct {
 func (e *ErrorParsingBodyInvalidBodySize) Error() string {
 	return fmt.Sprintf("error: invalid body size: content-length: %d, body size: %d, body: %s", e.ContentLength, e.BodySize, string(e.Body))
 }
+
+type ErrorParsingBodyInvalidChunkSize struct {
+	Line string
+}
+
+func (e *ErrorParsingBodyInvalidChunkSize) Error() string {
+	return fmt.Sprintf("error: invalid chunk size line: %s", e.Line)
+}
+
+type ErrorParsingBodyMalformedChunk struct {
+	Data string
+}
+
+func (e *ErrorParsingBodyMalformedChunk) Error() string {
+	return fmt.Sprintf("error: malformed chunk: expected CRLF after chunk data, got %q", e.Data)
+}
+
+type ErrorParsingTrailerForbiddenField struct {
+	Field string
+}
+
+func (e *ErrorParsingTrailerForbiddenField) Error() string {
+	return fmt.Sprintf("error: forbidden trailer field: %s", e.Field)
+}
+
+type ErrorParsingTrailerUndeclaredField struct {
+	Field string
+}
+
+func (e *ErrorParsingTrailerUndeclaredField) Error() string {
+	return fmt.Sprintf("error: trailer field not declared in Trailer header: %s", e.Field)
+}
+
+type ErrorParsingRequestLineTooLong struct {
+	Limit int
+}
+
+func (e *ErrorParsingRequestLineTooLong) Error() string {
+	return fmt.Sprintf("error: request line exceeds %d bytes", e.Limit)
+}
+
+type ErrorParsingHeadersTooLarge struct {
+	Limit int
+}
+
+func (e *ErrorParsingHeadersTooLarge) Error() string {
+	return fmt.Sprintf("error: header fields exceed %d bytes", e.Limit)
+}
+
+type ErrorParsingHeadersTooMany struct {
+	Limit int
+}
+
+func (e *ErrorParsingHeadersTooMany) Error() string {
+	return fmt.Sprintf("error: more than %d header fields", e.Limit)
+}
+
+type ErrorParsingBodyTooLarge struct {
+	Limit int
+}
+
+func (e *ErrorParsingBodyTooLarge) Error() string {
+	return fmt.Sprintf("error: body exceeds %d bytes", e.Limit)
+}
+
+type ErrorParsingBodyChunkLineTooLong struct {
+	Limit int
+}
+
+func (e *ErrorParsingBodyChunkLineTooLong) Error() string {
+	return fmt.Sprintf("error: chunk-size line exceeds %d bytes", e.Limit)
+}
+
+type ErrorBodyTooLargeToDrain struct {
+	Limit int
+}
+
+func (e *ErrorBodyTooLargeToDrain) Error() string {
+	return fmt.Sprintf("error: unread body exceeds %d bytes", e.Limit)
+}
+
+type ErrorParsingRequestAmbiguousFraming struct {
+	Reason string
+}
+
+func (e *ErrorParsingRequestAmbiguousFraming) Error() string {
+	return "error: ambiguous message framing: " + e.Reason
+}
+
+type ErrorParsingRequestUnsupportedTransferCoding struct {
+	Coding string
+}
+
+func (e *ErrorParsingRequestUnsupportedTransferCoding) Error() string {
+	return "error: unsupported transfer coding: " + e.Coding
+}
@@ -0,0 +1,99 @@
+package request
+
+import (
+	"strconv"
+	"strings"
+)
+
+// bodyFraming is how the end of a request body is found.
+type bodyFraming int
+
+const (
+	bodyFramingNone bodyFraming = iota
+	bodyFramingLength
+	bodyFramingChunked
+)
+
+// validateFraming decides how the body is delimited, following RFC 9112
+// section 6.3 strictly. A request whose framing two parsers could read
+// differently, the basis of request smuggling, is rejected with
+// ErrorParsingRequestAmbiguousFraming rather than guessed at:
+//
+//   - Transfer-Encoding together with Content-Length;
+//   - Transfer-Encoding in an HTTP/1.0 request;
+//   - Transfer-Encoding whose final coding is not a single "chunked";
+//   - a Content-Length that is not all digits, or that repeats with
+//     differing values.
+//
+// A Content-Length repeated with the same value is accepted.
+func (r *Request) validateFraming() (bodyFraming, error) {
+	if r.Headers.Has("transfer-encoding") {
+		if r.Headers.Has("content-length") {
+			return 0, &ErrorParsingRequestAmbiguousFraming{Reason: "both Transfer-Encoding and Content-Length present"}
+		}
+		if r.RequestLine.HttpVersion == "1.0" {
+			return 0, &ErrorParsingRequestAmbiguousFraming{Reason: "Transfer-Encoding in an HTTP/1.0 request"}
+		}
+		return bodyFramingChunked, r.validateTransferEncoding()
+	}
+	if r.Headers.Has("content-length") {
+		contentLength, err := r.validateContentLength()
+		if err != nil {
+			return 0, err
+		}
+		r.contentLength = contentLength
+		return bodyFramingLength, nil
+	}
+	return bodyFramingNone, nil
+}
+
+func (r *Request) validateTransferEncoding() error {
+	codings := listElements(r.Headers.Values("transfer-encoding"))
+	for i, coding := range codings {
+		if coding == "" {
+			return &ErrorParsingRequestAmbiguousFraming{Reason: "empty transfer coding"}
+		}
+		isChunked := strings.EqualFold(coding, "chunked")
+		last := i == len(codings)-1
+		if isChunked && !last {
+			return &ErrorParsingRequestAmbiguousFraming{Reason: "chunked is not the final transfer coding"}
+		}
+		if !isChunked && last {
+			return &ErrorParsingRequestAmbiguousFraming{Reason: "final transfer coding is not chunked: " + coding}
+		}
+	}
+	// Only chunked framing is decoded; any coding layered beneath it would
+	// be passed to the handler still encoded.
+	if len(codings) > 1 {
+		return &ErrorParsingRequestUnsupportedTransferCoding{Coding: codings[0]}
+	}
+	return nil
+}
+
+func (r *Request) validateContentLength() (int, error) {
+	values := listElements(r.Headers.Values("content-length"))
+	for _, value := range values {
+		if value == "" || strings.Trim(value, "0123456789") != "" {
+			return 0, &ErrorParsingRequestAmbiguousFraming{Reason: "invalid Content-Length: " + value}
+		}
+		if value != values[0] {
+			return 0, &ErrorParsingRequestAmbiguousFraming{Reason: "conflicting Content-Length values"}
+		}
+	}
+	contentLength, err := strconv.Atoi(values[0])
+	if err != nil {
+		return 0, &ErrorParsingBodyInvalidContentLength{ContentLength: values[0]}
+	}
+	return contentLength, r.checkBodySize(contentLength)
+}
+
+// listElements splits comma-separated field values into trimmed elements.
+func listElements(values []string) []string {
+	var elements []string
+	for _, value := range values {
+		for _, element := range strings.Split(value, ",") {
+			elements = append(elements, strings.TrimSpace(element))
+		}
+	}
+	return elements
+}
@@ -0,0 +1,90 @@
+package request
+
+import (
+	"bytes"
+)
+
+// Limits caps how much a client may send while a request is parsed. A zero
+// field disables that limit.
+type Limits struct {
+	MaxRequestLineLength int
+	MaxHeaderBytes       int
+	MaxHeaderCount       int
+	MaxBodyBytes         int
+	MaxChunkLineLength   int
+}
+
+func DefaultLimits() Limits {
+	return Limits{
+		MaxRequestLineLength: 8 << 10,
+		MaxHeaderBytes:       64 << 10,
+		MaxHeaderCount:       100,
+		MaxBodyBytes:         10 << 20,
+		MaxChunkLineLength:   4 << 10,
+	}
+}
+
+// checkRequestLine fails once the request line, complete or not, is longer
+// than allowed.
+func (r *Request) checkRequestLine(data []byte) error {
+	if lineTooLong(data, r.limits.MaxRequestLineLength) {
+		return &ErrorParsingRequestLineTooLong{Limit: r.limits.MaxRequestLineLength}
+	}
+	return nil
+}
+
+// checkChunkLine fails once a chunk-size line and its extensions, complete
+// or not, are longer than allowed.
+func (r *Request) checkChunkLine(data []byte) error {
+	if lineTooLong(data, r.limits.MaxChunkLineLength) {
+		return &ErrorParsingBodyChunkLineTooLong{Limit: r.limits.MaxChunkLineLength}
+	}
+	return nil
+}
+
+// lineTooLong reports whether the line at the start of data exceeds limit,
+// counting all of data when no CRLF has arrived yet.
+func lineTooLong(data []byte, limit int) bool {
+	if limit == 0 {
+		return false
+	}
+	lineLen := bytes.Index(data, []byte(CRLF))
+	if lineLen == -1 {
+		lineLen = len(data)
+	}
+	return lineLen > limit
+}
+
+// checkHeaderLimits accounts for the n bytes of field lines just parsed out
+// of data, counting any incomplete line still buffered towards the byte cap.
+// Header and trailer sections share the same budget.
+func (r *Request) checkHeaderLimits(data []byte, n int, done bool) error {
+	lines := bytes.Count(data[:n], []byte(CRLF))
+	if done {
+		lines--
+	}
+	r.headerBytes += n
+	r.headerCount += lines
+
+	if limit := r.limits.MaxHeaderBytes; limit > 0 {
+		size := r.headerBytes
+		if !done {
+			size += len(data) - n
+		}
+		if size > limit {
+			return &ErrorParsingHeadersTooLarge{Limit: limit}
+		}
+	}
+	if limit := r.limits.MaxHeaderCount; limit > 0 && r.headerCount > limit {
+		return &ErrorParsingHeadersTooMany{Limit: limit}
+	}
+	return nil
+}
+
+// checkBodySize fails if a body of size bytes would exceed the cap.
+func (r *Request) checkBodySize(size int) error {
+	if limit := r.limits.MaxBodyBytes; limit > 0 && size > limit {
+		return &ErrorParsingBodyTooLarge{Limit: limit}
+	}
+	return nil
+}
@@ -0,0 +1,223 @@
+package request
+
+import (
+	"bytes"
+	"errors"
+	"io"
+
+	"github.com/DimRev/httpfromtcp/internal/headers"
+)
+
+// Reader parses successive requests from a single connection. Bytes read
+// past the end of one request are kept and used for the next, so pipelined
+// requests are returned in the order they were sent.
+type Reader struct {
+	// StreamBody makes ReadRequest return as soon as the headers are parsed,
+	// leaving the body to be read lazily through Request.BodyReader.
+	StreamBody bool
+	// Limits bounds the size of each request read. NewReader starts from
+	// DefaultLimits.
+	Limits Limits
+	// ObsFold selects how header lines folded onto several lines are
+	// treated. The zero value rejects them.
+	ObsFold headers.ObsFold
+
+	reader      io.Reader
+	buf         []byte
+	readToIndex int
+	current     *Request
+}
+
+func NewReader(reader io.Reader) *Reader {
+	return &Reader{
+		Limits: DefaultLimits(),
+		reader: reader,
+		buf:    make([]byte, BUFFER_SIZE),
+	}
+}
+
+// Buffered returns the number of bytes read from the connection that have
+// not yet been consumed by a request.
+func (r *Reader) Buffered() int {
+	return r.readToIndex
+}
+
+// ReadRequest parses the next request, first draining any body the previous
+// request left unread. It returns io.EOF if the connection was closed cleanly
+// before any byte of a new request arrived.
+func (r *Reader) ReadRequest() (*Request, error) {
+	if err := r.discardCurrent(); err != nil {
+		return nil, err
+	}
+
+	req := newRequest()
+	req.streaming = r.StreamBody
+	req.limits = r.Limits
+	req.headerOptions = headers.ParseOptions{ObsFold: r.ObsFold}
+	if req.streaming {
+		req.Body = nil
+	}
+
+	for req.state != requestStateDone && !(req.streaming && req.headersParsed()) {
+		if err := r.step(req); err != nil {
+			return nil, err
+		}
+	}
+
+	if req.streaming {
+		req.BodyReader = &bodyReader{reader: r, req: req}
+	} else {
+		req.BodyReader = io.NopCloser(bytes.NewReader(req.Body))
+	}
+	r.current = req
+	return req, nil
+}
+
+// BodyConsumed reports whether the body of the last request returned has
+// been read to the end, so the connection can be read from again.
+func (r *Reader) BodyConsumed() bool {
+	return r.current == nil || r.current.state == requestStateDone
+}
+
+// WaitForRequest blocks until at least one byte of the next request has
+// been read, so callers can time the wait between requests separately from
+// reading the request itself. It returns io.EOF if the connection is closed
+// cleanly first.
+func (r *Reader) WaitForRequest() error {
+	if err := r.discardCurrent(); err != nil {
+		return err
+	}
+	for r.readToIndex == 0 {
+		numBytesRead, err := r.reader.Read(r.buf)
+		r.readToIndex += numBytesRead
+		if err != nil && r.readToIndex == 0 {
+			if errors.Is(err, io.EOF) {
+				return io.EOF
+			}
+			return &ErrorUnexpectedReadError{Err: err}
+		}
+	}
+	return nil
+}
+
+// discardCurrent drains whatever body the last request left unread.
+func (r *Reader) discardCurrent() error {
+	if r.current == nil {
+		return nil
+	}
+	if err := r.current.BodyReader.Close(); err != nil {
+		return err
+	}
+	r.current = nil
+	return nil
+}
+
+// step advances req by parsing buffered bytes, reading more from the
+// connection only when the buffer holds nothing the parser can use.
+func (r *Reader) step(req *Request) error {
+	prevState := req.state
+	numBytesParsed, err := req.parse(r.buf[:r.readToIndex])
+	if err != nil {
+		return err
+	}
+	if numBytesParsed > 0 {
+		copy(r.buf, r.buf[numBytesParsed:r.readToIndex])
+		r.readToIndex -= numBytesParsed
+		return nil
+	}
+	if req.state != prevState {
+		return nil
+	}
+
+	if r.readToIndex >= len(r.buf) {
+		newBuf := make([]byte, len(r.buf)*2)
+		copy(newBuf, r.buf)
+		r.buf = newBuf
+	}
+
+	numBytesRead, err := r.reader.Read(r.buf[r.readToIndex:])
+	r.readToIndex += numBytesRead
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			if numBytesRead > 0 {
+				return nil
+			}
+			return r.unexpectedEOF(req)
+		}
+		return &ErrorUnexpectedReadError{Err: err}
+	}
+	return nil
+}
+
+func (r *Reader) unexpectedEOF(req *Request) error {
+	if req.state == requestStateInitialized && r.readToIndex == 0 {
+		return io.EOF
+	}
+	if req.state == requestStateParsingBody {
+		return &ErrorParsingBodyInvalidBodySize{
+			ContentLength: req.contentLength,
+			BodySize:      req.bodyLen,
+			Body:          req.Body,
+		}
+	}
+	return &ErrorIncompleteRequest{}
+}
+
+// bodyReader streams a request body straight from the connection, decoding
+// Content-Length or chunked framing as it goes.
+type bodyReader struct {
+	reader *Reader
+	req    *Request
+	err    error
+}
+
+func (b *bodyReader) Read(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	for len(b.req.pending) == 0 {
+		if b.req.state == requestStateDone {
+			return 0, io.EOF
+		}
+		if err := b.reader.step(b.req); err != nil {
+			b.err = err
+			return 0, err
+		}
+	}
+	n := copy(p, b.req.pending)
+	b.req.pending = b.req.pending[n:]
+	return n, nil
+}
+
+// BodyError returns the error that ended reading a streamed body, such as
+// ErrorParsingBodyTooLarge, or nil if there was none.
+func (r *Request) BodyError() error {
+	if b, ok := r.BodyReader.(*bodyReader); ok {
+		return b.err
+	}
+	return nil
+}
+
+// maxDrainBytes bounds how much of an unread body Close discards. Reading
+// past it is not worth keeping the connection for.
+const maxDrainBytes = 256 << 10
+
+// Close discards whatever is left of the body so the connection is
+// positioned at the start of the next request. It fails if more than
+// maxDrainBytes remain, in which case the connection should be closed.
+func (b *bodyReader) Close() error {
+	_, err := io.CopyN(io.Discard, b, maxDrainBytes)
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := b.Read(make([]byte, 1)); err == io.EOF {
+		return nil
+	}
+	if b.err == nil {
+		b.err = &ErrorBodyTooLargeToDrain{Limit: maxDrainBytes}
+	}
+	return b.err
+}
@@ -2,7 +2,8 @@ package request
 
 import (
 	"bytes"
-	"errors"
+	"context"
+	"crypto/tls"
 	"io"
 	"slices"
 	"strconv"
@@ -15,10 +16,33 @@ import (
 
 type Request struct {
 	RequestLine RequestLine
-	Headers     headers.Headers
-	Body        []byte
-
-	state requestState
+	// Target is RequestLine.RequestTarget parsed into its components.
+	Target  Target
+	Headers *headers.Headers
+	// Body holds the whole payload unless the request was read in streaming
+	// mode, in which case it is nil and the payload comes from BodyReader.
+	Body []byte
+	// BodyReader reads the payload. It is always set; for buffered requests
+	// it reads from Body.
+	BodyReader io.ReadCloser
+	// Trailers is only complete once the body has been fully read.
+	Trailers *headers.Headers
+	// TLS describes the connection's TLS session, or is nil for plain
+	// connections.
+	TLS *tls.ConnectionState
+
+	ctx           context.Context
+	pathValues    map[string]string
+	state         requestState
+	limits        Limits
+	headerOptions headers.ParseOptions
+	contentLength int
+	chunkSize     int
+	bodyLen       int
+	headerBytes   int
+	headerCount   int
+	streaming     bool
+	pending       []byte
 }
 
 type RequestLine struct {
@@ -27,15 +51,46 @@ type RequestLine struct {
 	Method        string
 }
 
-const BUFFER_SIZE = 8
+const (
+	MethodGet     = "GET"
+	MethodHead    = "HEAD"
+	MethodPost    = "POST"
+	MethodPut     = "PUT"
+	MethodPatch   = "PATCH"
+	MethodDelete  = "DELETE"
+	MethodConnect = "CONNECT"
+	MethodOptions = "OPTIONS"
+	MethodTrace   = "TRACE"
+)
+
+var standardMethods = []string{
+	MethodGet, MethodHead, MethodPost, MethodPut, MethodPatch,
+	MethodDelete, MethodConnect, MethodOptions, MethodTrace,
+}
+
+// IsStandardMethod reports whether method is one of the RFC 9110 methods or
+// PATCH. Any other token is an extension method.
+func IsStandardMethod(method string) bool {
+	return slices.Contains(standardMethods, method)
+}
+
+// BUFFER_SIZE is how much a Reader reads from its connection at a time to
+// begin with; the buffer grows when a single line needs more.
+const BUFFER_SIZE = 4 << 10
 const CRLF = "\r\n"
 
+const hexDigits = "0123456789abcdefABCDEF"
+
 type requestState int
 
 const (
 	requestStateInitialized requestState = iota
 	requestStateParsingHeaders
 	requestStateParsingBody
+	requestStateParsingChunkSize
+	requestStateParsingChunkData
+	requestStateParsingChunkDataEnd
+	requestStateParsingTrailers
 	requestStateDone
 )
 
@@ -47,77 +102,61 @@ func NewRequestLine() RequestLine {
 	}
 }
 
-func RequestFromReader(reader io.Reader) (*Request, error) {
-	buf := make([]byte, BUFFER_SIZE)
-	readToIndex := 0
-	req := &Request{
-		Headers: headers.NewHeaders(),
-		Body:    []byte{},
-		state:   requestStateInitialized,
+// Context returns the request's context. The server cancels it when the
+// connection closes, the server is forced to stop or the handler deadline
+// passes. It is never nil.
+func (r *Request) Context() context.Context {
+	if r.ctx == nil {
+		return context.Background()
 	}
+	return r.ctx
+}
 
-	for req.state != requestStateDone {
-		if readToIndex >= len(buf) {
-			newBuf := make([]byte, len(buf)*2)
-			copy(newBuf, buf)
-			buf = newBuf
-		}
-
-		numBytesRead, err := reader.Read(buf[readToIndex:])
-		if err != nil {
-			if errors.Is(err, io.EOF) {
-				if req.state == requestStateParsingBody {
-					contentLengthStr := req.Headers.Get("content-length")
-					if contentLengthStr != "" {
-						contentLength, err := strconv.Atoi(contentLengthStr)
-						if err != nil {
-							return nil, &ErrorParsingBodyInvalidContentLength{
-								ContentLength: contentLengthStr,
-							}
-						}
-						if len(req.Body) != contentLength {
-							return nil, &ErrorParsingBodyInvalidBodySize{
-								ContentLength: contentLength,
-								BodySize:      len(req.Body),
-								Body:          req.Body,
-							}
-						}
-					}
-				}
-				if req.state != requestStateDone {
-					return nil, &ErrorIncompleteRequest{}
-				}
-				break
-			}
-			return nil, &ErrorUnexpectedReadError{Err: err}
-		}
+// WithContext returns a shallow copy of r with its context replaced by ctx,
+// which lets middleware attach values or deadlines for later handlers.
+func (r *Request) WithContext(ctx context.Context) *Request {
+	r2 := *r
+	r2.ctx = ctx
+	return &r2
+}
 
-		readToIndex += numBytesRead
+// PathValue returns the value a router matched for the named path
+// parameter, or "" if there is none.
+func (r *Request) PathValue(name string) string {
+	return r.pathValues[name]
+}
 
-		numBytesParsed, err := req.parse(buf[:readToIndex])
-		if err != nil {
-			return nil, err
-		}
+func (r *Request) SetPathValue(name, value string) {
+	if r.pathValues == nil {
+		r.pathValues = map[string]string{}
+	}
+	r.pathValues[name] = value
+}
 
-		copy(buf, buf[numBytesParsed:])
-		readToIndex -= numBytesParsed
+func newRequest() *Request {
+	return &Request{
+		Headers:  headers.NewHeaders(),
+		Body:     []byte{},
+		state:    requestStateInitialized,
+		Trailers: headers.NewHeaders(),
 	}
+}
 
-	contentLengthStr := req.Headers.Get("content-length")
-	if contentLengthStr != "" {
-		contentLength, err := strconv.Atoi(contentLengthStr)
-		if err != nil {
-			return nil, &ErrorParsingBodyInvalidContentLength{
-				ContentLength: contentLengthStr,
-			}
-		}
+// RequestFromReader parses a single request from reader. Bytes following a
+// Content-Length body are treated as part of an oversized body; use a Reader
+// to parse several pipelined requests from one connection.
+func RequestFromReader(reader io.Reader) (*Request, error) {
+	r := NewReader(reader)
+	req, err := r.ReadRequest()
+	if err != nil {
+		return nil, err
+	}
 
-		if len(req.Body) != contentLength {
-			return nil, &ErrorParsingBodyInvalidBodySize{
-				ContentLength: contentLength,
-				BodySize:      len(req.Body),
-				Body:          req.Body,
-			}
+	if req.Headers.Has("content-length") && r.Buffered() > 0 {
+		return nil, &ErrorParsingBodyInvalidBodySize{
+			ContentLength: req.contentLength,
+			BodySize:      len(req.Body) + r.Buffered(),
+			Body:          append(req.Body, r.buf[:r.readToIndex]...),
 		}
 	}
 
@@ -127,7 +166,10 @@ func RequestFromReader(reader io.Reader) (*Request, error) {
 func (r *Request) parse(currentBuffer []byte) (int, error) {
 	switch r.state {
 	case requestStateInitialized:
-		requestLine, n, err := parseRequestLine(currentBuffer)
+		if err := r.checkRequestLine(currentBuffer); err != nil {
+			return 0, err
+		}
+		requestLine, target, n, err := parseRequestLine(currentBuffer)
 		if err != nil {
 			return 0, err
 		}
@@ -135,49 +177,94 @@ func (r *Request) parse(currentBuffer []byte) (int, error) {
 			return 0, nil
 		}
 		r.RequestLine = *requestLine
+		r.Target = *target
 		r.state = requestStateParsingHeaders
 		return n, nil
 	case requestStateParsingHeaders:
-		n, done, err := r.Headers.Parse(currentBuffer)
+		n, done, err := r.Headers.ParseWithOptions(currentBuffer, r.headerOptions)
 		if err != nil {
 			return 0, err
 		}
+		if err := r.checkHeaderLimits(currentBuffer, n, done); err != nil {
+			return 0, err
+		}
 		if done {
-			r.state = requestStateParsingBody
-			if r.Headers.Get("content-length") == "" {
+			framing, err := r.validateFraming()
+			if err != nil {
+				return 0, err
+			}
+			switch framing {
+			case bodyFramingChunked:
+				r.state = requestStateParsingChunkSize
+			case bodyFramingLength:
+				r.state = requestStateParsingBody
+			default:
 				r.state = requestStateDone
 			}
 		}
 		return n, nil
 	case requestStateParsingBody:
-		contentLengthStr := r.Headers.Get("content-length")
-		if contentLengthStr == "" {
+		bytesToRead := min(len(currentBuffer), r.contentLength-r.bodyLen)
+		n := r.appendBody(currentBuffer[:bytesToRead])
+
+		if r.bodyLen >= r.contentLength {
 			r.state = requestStateDone
-			return 0, nil
 		}
 
-		contentLength, err := strconv.Atoi(contentLengthStr)
+		return n, nil
+	case requestStateParsingChunkSize:
+		if err := r.checkChunkLine(currentBuffer); err != nil {
+			return 0, err
+		}
+		chunkSize, n, err := parseChunkSize(currentBuffer)
 		if err != nil {
-			return 0, &ErrorParsingBodyInvalidContentLength{
-				ContentLength: r.Headers.Get("content-length"),
+			return 0, err
+		}
+		if n == 0 {
+			return 0, nil
+		}
+		if err := r.checkBodySize(r.bodyLen + chunkSize); err != nil {
+			return 0, err
+		}
+		r.chunkSize = chunkSize
+		r.state = requestStateParsingChunkData
+		if chunkSize == 0 {
+			r.state = requestStateParsingTrailers
+		}
+		return n, nil
+	case requestStateParsingChunkData:
+		bytesToRead := min(len(currentBuffer), r.chunkSize)
+		n := r.appendBody(currentBuffer[:bytesToRead])
+		r.chunkSize -= n
+		if r.chunkSize == 0 {
+			r.state = requestStateParsingChunkDataEnd
+		}
+		return n, nil
+	case requestStateParsingChunkDataEnd:
+		if len(currentBuffer) < len(CRLF) {
+			return 0, nil
+		}
+		if !bytes.HasPrefix(currentBuffer, []byte(CRLF)) {
+			return 0, &ErrorParsingBodyMalformedChunk{
+				Data: string(currentBuffer[:len(CRLF)]),
 			}
 		}
-
-		bytesToRead := len(currentBuffer)
-		newBody, n, err := parseBody(
-			currentBuffer[:bytesToRead],
-			r.Body,
-		)
+		r.state = requestStateParsingChunkSize
+		return len(CRLF), nil
+	case requestStateParsingTrailers:
+		n, done, err := r.Trailers.ParseWithOptions(currentBuffer, r.headerOptions)
 		if err != nil {
 			return 0, err
 		}
-
-		r.Body = newBody
-
-		if len(r.Body) >= contentLength {
+		if err := r.checkHeaderLimits(currentBuffer, n, done); err != nil {
+			return 0, err
+		}
+		if done {
+			if err := r.validateTrailers(); err != nil {
+				return 0, err
+			}
 			r.state = requestStateDone
 		}
-
 		return n, nil
 	case requestStateDone:
 		return 0, &ErrorParsingTryingToReadAfterDone{}
@@ -186,47 +273,107 @@ func (r *Request) parse(currentBuffer []byte) (int, error) {
 	}
 }
 
-func parseBody(data, origBody []byte) ([]byte, int, error) {
-	newBody := append(origBody, data...)
-	return newBody, len(data), nil
+// appendBody records decoded body bytes, buffering them in Body or, when
+// streaming, holding them until BodyReader hands them to the caller.
+func (r *Request) appendBody(data []byte) int {
+	r.bodyLen += len(data)
+	if r.streaming {
+		r.pending = append(r.pending, data...)
+	} else {
+		r.Body = append(r.Body, data...)
+	}
+	return len(data)
 }
 
-func parseRequestLine(data []byte) (*RequestLine, int, error) {
+func (r *Request) headersParsed() bool {
+	return r.state != requestStateInitialized && r.state != requestStateParsingHeaders
+}
+
+// forbiddenTrailers are fields that control framing or routing and so must
+// never be sent after the body.
+var forbiddenTrailers = []string{"content-length", "host", "transfer-encoding"}
+
+// validateTrailers rejects forbidden trailer fields and, when the request
+// announced its trailers with a Trailer header, any field it did not declare.
+func (r *Request) validateTrailers() error {
+	declared := r.Headers.Has("trailer")
+	for key := range r.Trailers.All() {
+		if slices.Contains(forbiddenTrailers, strings.ToLower(key)) {
+			return &ErrorParsingTrailerForbiddenField{Field: key}
+		}
+		if declared && !r.Headers.ContainsToken("trailer", key) {
+			return &ErrorParsingTrailerUndeclaredField{Field: key}
+		}
+	}
+	return nil
+}
+
+// parseChunkSize parses a chunk-size line, ignoring any chunk extensions
+// that follow the hexadecimal size.
+func parseChunkSize(data []byte) (int, int, error) {
+	idx := bytes.Index(data, []byte(CRLF))
+	if idx == -1 {
+		return 0, 0, nil
+	}
+	line := string(data[:idx])
+	sizeStr, extensions, hasExtensions := strings.Cut(line, ";")
+	// Whitespace may only come between the size and a chunk extension.
+	if hasExtensions {
+		sizeStr = strings.TrimRight(sizeStr, " \t")
+	}
+	if sizeStr == "" || len(sizeStr) > 15 || strings.Trim(sizeStr, hexDigits) != "" {
+		return 0, 0, &ErrorParsingBodyInvalidChunkSize{Line: line}
+	}
+	size, err := strconv.ParseInt(sizeStr, 16, 64)
+	if err != nil {
+		return 0, 0, &ErrorParsingBodyInvalidChunkSize{Line: line}
+	}
+	if hasExtensions {
+		for _, ext := range strings.Split(extensions, ";") {
+			name, _, _ := strings.Cut(ext, "=")
+			if strings.TrimSpace(name) == "" {
+				return 0, 0, &ErrorParsingBodyInvalidChunkSize{Line: line}
+			}
+		}
+	}
+	return int(size), idx + len(CRLF), nil
+}
+
+func parseRequestLine(data []byte) (*RequestLine, *Target, int, error) {
 	idx := bytes.Index(data, []byte(CRLF))
 	if idx == -1 {
-		return nil, 0, nil
+		return nil, nil, 0, nil
 	}
 	line := string(data[:idx])
 	parts := strings.Split(line, " ")
 	if len(parts) != 3 {
-		return nil, 0, &ErrorParsingRequestLineMalformed{Line: line}
+		return nil, nil, 0, &ErrorParsingRequestLineMalformed{Line: line}
 	}
 
 	method, err := assignMethod(parts[0])
 	if err != nil {
-		return nil, 0, err
+		return nil, nil, 0, err
 	}
-	target, err := assignRequestTarget(parts[1])
+	target, err := ParseTarget(method, parts[1])
 	if err != nil {
-		return nil, 0, err
+		return nil, nil, 0, err
 	}
 	version, err := assignHttpVersion(parts[2])
 	if err != nil {
-		return nil, 0, err
+		return nil, nil, 0, err
 	}
 
 	requestLine := &RequestLine{
 		Method:        method,
-		RequestTarget: target,
+		RequestTarget: parts[1],
 		HttpVersion:   version,
 	}
 
-	return requestLine, idx + len(CRLF), nil
+	return requestLine, target, idx + len(CRLF), nil
 }
 
 func assignMethod(m string) (string, error) {
-	validMethods := []string{"GET", "POST", "PUT", "DELETE"}
-	if !slices.Contains(validMethods, m) {
+	if !headers.IsToken(m) {
 		return "", &ErrorParsingRequestInvalidMethod{
 			Method: m,
 		}
@@ -234,26 +381,27 @@ func assignMethod(m string) (string, error) {
 	return m, nil
 }
 
-func assignRequestTarget(target string) (string, error) {
-	if !strings.HasPrefix(target, "/") {
-		return "", &ErrorParsingRequestInvalidTarget{
-			Target: target,
-		}
-	}
-	return target, nil
-}
-
+// assignHttpVersion accepts any HTTP/1.x version, treating minor versions
+// above 1 as 1.1. Well-formed versions with another major are unsupported.
 func assignHttpVersion(version string) (string, error) {
-	if version != "HTTP/1.1" {
+	name, number, found := strings.Cut(version, "/")
+	if !found || name != "HTTP" || len(number) != 3 || number[1] != '.' ||
+		!isDigit(number[0]) || !isDigit(number[2]) {
 		return "", &ErrorParsingRequestInvalidVersion{
 			Version: version,
 		}
 	}
-	parts := strings.Split(version, "/")
-	if len(parts) != 2 {
-		return "", &ErrorParsingRequestInvalidVersion{
+	if number[0] != '1' {
+		return "", &ErrorParsingRequestUnsupportedVersion{
 			Version: version,
 		}
 	}
-	return parts[1], nil
+	if number == "1.0" {
+		return "1.0", nil
+	}
+	return "1.1", nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
 }
@@ -3,6 +3,8 @@ package request
 import (
 	"errors"
 	"io"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/DimRev/httpfromtcp/internal/headers"
@@ -81,9 +83,9 @@ func TestRequestLineParse(t *testing.T) {
 		assert.Equal(t, "GET", r.RequestLine.Method)
 		assert.Equal(t, "/", r.RequestLine.RequestTarget)
 		assert.Equal(t, "1.1", r.RequestLine.HttpVersion)
-		assert.Equal(t, "localhost:42069", r.Headers["host"])
-		assert.Equal(t, "curl/7.81.0", r.Headers["user-agent"])
-		assert.Equal(t, "*/*", r.Headers["accept"])
+		assert.Equal(t, "localhost:42069", r.Headers.Get("host"))
+		assert.Equal(t, "curl/7.81.0", r.Headers.Get("user-agent"))
+		assert.Equal(t, "*/*", r.Headers.Get("accept"))
 		assert.Equal(t, []byte{}, r.Body)
 
 		// POST method
@@ -94,9 +96,9 @@ func TestRequestLineParse(t *testing.T) {
 		assert.Equal(t, "POST", r.RequestLine.Method)
 		assert.Equal(t, "/submit", r.RequestLine.RequestTarget)
 		assert.Equal(t, "1.1", r.RequestLine.HttpVersion)
-		assert.Equal(t, "localhost:42069", r.Headers["host"])
-		assert.Equal(t, "curl/7.81.0", r.Headers["user-agent"])
-		assert.Equal(t, "*/*", r.Headers["accept"])
+		assert.Equal(t, "localhost:42069", r.Headers.Get("host"))
+		assert.Equal(t, "curl/7.81.0", r.Headers.Get("user-agent"))
+		assert.Equal(t, "*/*", r.Headers.Get("accept"))
 		assert.Equal(t, []byte{}, r.Body)
 
 		// PUT method
@@ -107,9 +109,9 @@ func TestRequestLineParse(t *testing.T) {
 		assert.Equal(t, "PUT", r.RequestLine.Method)
 		assert.Equal(t, "/update", r.RequestLine.RequestTarget)
 		assert.Equal(t, "1.1", r.RequestLine.HttpVersion)
-		assert.Equal(t, "localhost:42069", r.Headers["host"])
-		assert.Equal(t, "curl/7.81.0", r.Headers["user-agent"])
-		assert.Equal(t, "*/*", r.Headers["accept"])
+		assert.Equal(t, "localhost:42069", r.Headers.Get("host"))
+		assert.Equal(t, "curl/7.81.0", r.Headers.Get("user-agent"))
+		assert.Equal(t, "*/*", r.Headers.Get("accept"))
 		assert.Equal(t, []byte{}, r.Body)
 
 		// DELETE method
@@ -120,18 +122,36 @@ func TestRequestLineParse(t *testing.T) {
 		assert.Equal(t, "DELETE", r.RequestLine.Method)
 		assert.Equal(t, "/resource", r.RequestLine.RequestTarget)
 		assert.Equal(t, "1.1", r.RequestLine.HttpVersion)
-		assert.Equal(t, "localhost:42069", r.Headers["host"])
-		assert.Equal(t, "curl/7.81.0", r.Headers["user-agent"])
-		assert.Equal(t, "*/*", r.Headers["accept"])
+		assert.Equal(t, "localhost:42069", r.Headers.Get("host"))
+		assert.Equal(t, "curl/7.81.0", r.Headers.Get("user-agent"))
+		assert.Equal(t, "*/*", r.Headers.Get("accept"))
 		assert.Equal(t, []byte{}, r.Body)
+
+		// Remaining standard methods
+		for _, method := range []string{"HEAD", "PATCH", "OPTIONS", "CONNECT", "TRACE"} {
+			target := "/"
+			if method == "CONNECT" {
+				target = "localhost:42069"
+			}
+			r, err = RequestFromReader(NewChunkReader(method, target, "HTTP/1.1", headers, "", 3))
+			require.NoError(t, err)
+			assert.Equal(t, method, r.RequestLine.Method)
+			assert.True(t, IsStandardMethod(r.RequestLine.Method))
+		}
+
+		// Extension methods are any valid token
+		for _, method := range []string{"get", "GETT", "GLAZE", "RIZZ", "M-SEARCH", "PROPFIND"} {
+			r, err = RequestFromReader(NewChunkReader(method, "/", "HTTP/1.1", headers, "", 3))
+			require.NoError(t, err)
+			assert.Equal(t, method, r.RequestLine.Method)
+			assert.False(t, IsStandardMethod(r.RequestLine.Method))
+		}
 	})
 
 	// Group 2: Invalid methods
 	t.Run("invalid methods", func(t *testing.T) {
 		invalidMethods := []string{
-			"PATCH", "HEAD", "OPTIONS", "CONNECT", "TRACE", // Not supported in implementation
-			"get", "put", "post", "delete", // Lowercase
-			"GETT", "GLAZE", "RIZZ", "PUTT", "POSTT", "DELETET", // Non-existent method
+			"G@T", "GET/", "(GET)", "GE:T", "\"GET\"", "GE\tT", // Not a token
 		}
 
 		for _, method := range invalidMethods {
@@ -154,19 +174,38 @@ func TestRequestLineParse(t *testing.T) {
 		require.NoError(t, err)
 		require.NotNil(t, r)
 		assert.Equal(t, "1.1", r.RequestLine.HttpVersion)
+
+		r, err = RequestFromReader(NewChunkReader("GET", "/", "HTTP/1.0", []string{"Host: localhost:42069"}, "", 3))
+		require.NoError(t, err)
+		require.NotNil(t, r)
+		assert.Equal(t, "1.0", r.RequestLine.HttpVersion)
+
+		// Later minor versions are treated as 1.1
+		r, err = RequestFromReader(NewChunkReader("GET", "/", "HTTP/1.2", []string{"Host: localhost:42069"}, "", 3))
+		require.NoError(t, err)
+		require.NotNil(t, r)
+		assert.Equal(t, "1.1", r.RequestLine.HttpVersion)
 	})
 
 	// Group 4: Invalid versions
+	t.Run("unsupported versions", func(t *testing.T) {
+		for _, version := range []string{"HTTP/2.0", "HTTP/3.0", "HTTP/0.9"} {
+			_, err := RequestFromReader(NewChunkReader("GET", "/", version, []string{"Host: localhost:42069"}, "", 3))
+			require.Error(t, err)
+			var errUnsupportedVersion *ErrorParsingRequestUnsupportedVersion
+			require.True(t, errors.As(err, &errUnsupportedVersion), "Version %s should be unsupported", version)
+		}
+	})
+
 	t.Run("invalid versions", func(t *testing.T) {
 		invalidVersions := []string{
-			"HTTP/1.0", // Not 1.1
-			"HTTP/2.0", // Not 1.1
-			"HTTP/0.9", // Not 1.1
-			"HTTP/",    // No version number
-			"HTTP",     // Missing slash and version
-			"http/1.1", // Lowercase
-			"1.1",      // Missing HTTP/
-			"",         // Empty
+			"HTTP/1.10", // Multi-digit minor
+			"HTTP/1",    // Missing minor
+			"HTTP/",     // No version number
+			"HTTP",      // Missing slash and version
+			"http/1.1",  // Lowercase
+			"1.1",       // Missing HTTP/
+			"",          // Empty
 		}
 
 		for _, version := range invalidVersions {
@@ -213,8 +252,12 @@ func TestRequestLineParse(t *testing.T) {
 	// Group 6: Invalid targets
 	t.Run("invalid targets", func(t *testing.T) {
 		invalidTargets := []string{
-			"no-leading-slash",   // Missing leading slash
-			"http://example.com", // Absolute URL not starting with /
+			"no-leading-slash",    // Missing leading slash
+			"example.com:443",     // Authority form without CONNECT
+			"*",                   // Asterisk form without OPTIONS
+			"http://",             // Absolute form without host
+			"1http://example.com", // Invalid scheme
+			"/bad%zzescape",       // Invalid percent-encoding
 		}
 
 		for _, target := range invalidTargets {
@@ -256,15 +299,15 @@ func TestRequestLineParse(t *testing.T) {
 					"Transfer-Encoding: chunked",
 					"User-Agent: curl/7.81.0",
 					"Accept: */*",
-					"",
 					"Connection: close",
 				},
-				"",
+				"5\r\nHello\r\n8;name=value\r\n, World!\r\n0\r\n\r\n",
 				chunkSize,
 			),
 			)
 			require.NoError(t, err)
 			require.NotNil(t, r)
+			assert.Equal(t, []byte("Hello, World!"), r.Body)
 		}
 	})
 
@@ -293,7 +336,7 @@ func TestRequestLineParse(t *testing.T) {
 		r, err := RequestFromReader(NewChunkReader("POST", "/test", "HTTP/1.1", []string{"Content-Length: 13"}, body, 3))
 		assert.NoError(t, err)
 		assert.NotNil(t, r)
-		assert.Equal(t, "13", r.Headers["content-length"])
+		assert.Equal(t, "13", r.Headers.Get("content-length"))
 		assert.Equal(t, []byte(body), r.Body)
 
 		_, err = RequestFromReader(NewChunkReader("POST", "/test", "HTTP/1.1", []string{"Content-Length: 3"}, "Hello World!\n", 10))
@@ -307,3 +350,495 @@ func TestRequestLineParse(t *testing.T) {
 		require.True(t, errors.As(err, &errInvalidBodySize2), "Expected error for invalid body size")
 	})
 }
+
+func TestReaderPipelining(t *testing.T) {
+	t.Run("pipelined requests in order", func(t *testing.T) {
+		data := generateRequest("GET", "/first", "HTTP/1.1", "", []string{"Host: localhost:42069"}) +
+			generateRequest("POST", "/second", "HTTP/1.1", "hello", []string{"Host: localhost:42069", "Content-Length: 5"}) +
+			generateRequest("DELETE", "/third", "HTTP/1.1", "", []string{"Host: localhost:42069"})
+
+		for _, chunkSize := range []int{1, 3, 10, 1000} {
+			reader := NewReader(&chunkReader{data: data, numBytesPerRead: chunkSize})
+
+			r, err := reader.ReadRequest()
+			require.NoError(t, err)
+			assert.Equal(t, "GET", r.RequestLine.Method)
+			assert.Equal(t, "/first", r.RequestLine.RequestTarget)
+
+			r, err = reader.ReadRequest()
+			require.NoError(t, err)
+			assert.Equal(t, "POST", r.RequestLine.Method)
+			assert.Equal(t, "/second", r.RequestLine.RequestTarget)
+			assert.Equal(t, []byte("hello"), r.Body)
+
+			r, err = reader.ReadRequest()
+			require.NoError(t, err)
+			assert.Equal(t, "DELETE", r.RequestLine.Method)
+			assert.Equal(t, "/third", r.RequestLine.RequestTarget)
+
+			_, err = reader.ReadRequest()
+			assert.ErrorIs(t, err, io.EOF)
+		}
+	})
+
+	t.Run("truncated second request", func(t *testing.T) {
+		data := generateRequest("GET", "/first", "HTTP/1.1", "", []string{"Host: localhost:42069"}) + "GET /sec"
+		reader := NewReader(&chunkReader{data: data, numBytesPerRead: 4})
+
+		_, err := reader.ReadRequest()
+		require.NoError(t, err)
+
+		_, err = reader.ReadRequest()
+		require.Error(t, err)
+		var errIncomplete *ErrorIncompleteRequest
+		require.True(t, errors.As(err, &errIncomplete), "Expected error for incomplete request")
+	})
+}
+
+func TestChunkedBodyParse(t *testing.T) {
+	chunkedHeaders := []string{"Host: localhost:42069", "Transfer-Encoding: chunked"}
+
+	t.Run("valid chunked body", func(t *testing.T) {
+		body := "4\r\nWiki\r\n7\r\npedia i\r\nB\r\nn \r\nchunks.\r\n0\r\n\r\n"
+		for _, chunkSize := range []int{1, 3, 10, 1000} {
+			r, err := RequestFromReader(NewChunkReader("POST", "/upload", "HTTP/1.1", chunkedHeaders, body, chunkSize))
+			require.NoError(t, err)
+			assert.Equal(t, []byte("Wikipedia in \r\nchunks."), r.Body)
+		}
+	})
+
+	t.Run("chunk extensions and trailers", func(t *testing.T) {
+		body := "3;foo=bar;baz\r\nabc\r\n0;last\r\nX-Checksum: 1234\r\n\r\n"
+		r, err := RequestFromReader(NewChunkReader("POST", "/upload", "HTTP/1.1", chunkedHeaders, body, 3))
+		require.NoError(t, err)
+		assert.Equal(t, []byte("abc"), r.Body)
+		assert.Equal(t, "1234", r.Trailers.Get("X-Checksum"))
+	})
+
+	t.Run("next request is not consumed", func(t *testing.T) {
+		data := generateRequest("POST", "/upload", "HTTP/1.1", "3\r\nabc\r\n0\r\n\r\n", chunkedHeaders) +
+			generateRequest("GET", "/next", "HTTP/1.1", "", []string{"Host: localhost:42069"})
+		reader := NewReader(&chunkReader{data: data, numBytesPerRead: 7})
+
+		r, err := reader.ReadRequest()
+		require.NoError(t, err)
+		assert.Equal(t, []byte("abc"), r.Body)
+
+		r, err = reader.ReadRequest()
+		require.NoError(t, err)
+		assert.Equal(t, "/next", r.RequestLine.RequestTarget)
+	})
+
+	t.Run("invalid chunk sizes", func(t *testing.T) {
+		invalidBodies := []string{
+			"\r\nabc\r\n0\r\n\r\n",     // Missing size
+			"zz\r\nabc\r\n0\r\n\r\n",   // Not hex
+			"-3\r\nabc\r\n0\r\n\r\n",   // Negative
+			"+3\r\nabc\r\n0\r\n\r\n",   // Signed
+			"0x3\r\nabc\r\n0\r\n\r\n",  // Prefixed
+			";ext\r\nabc\r\n0\r\n\r\n", // Extension only
+			"3;\r\nabc\r\n0\r\n\r\n",   // Empty extension
+			"3 \r\nabc\r\n0\r\n\r\n",   // Trailing whitespace
+			"ffffffffffffffff\r\n",     // Overflow
+		}
+		for _, body := range invalidBodies {
+			_, err := RequestFromReader(NewChunkReader("POST", "/upload", "HTTP/1.1", chunkedHeaders, body, 3))
+			require.Error(t, err)
+			var errInvalidChunkSize *ErrorParsingBodyInvalidChunkSize
+			require.True(t, errors.As(err, &errInvalidChunkSize), "Body %q should have an invalid chunk size", body)
+		}
+	})
+
+	t.Run("chunk data longer than size", func(t *testing.T) {
+		_, err := RequestFromReader(NewChunkReader("POST", "/upload", "HTTP/1.1", chunkedHeaders, "3\r\nabcd\r\n0\r\n\r\n", 3))
+		require.Error(t, err)
+		var errMalformedChunk *ErrorParsingBodyMalformedChunk
+		require.True(t, errors.As(err, &errMalformedChunk), "Expected error for malformed chunk")
+	})
+
+	t.Run("missing terminating chunk", func(t *testing.T) {
+		_, err := RequestFromReader(NewChunkReader("POST", "/upload", "HTTP/1.1", chunkedHeaders, "3\r\nabc\r\n", 3))
+		require.Error(t, err)
+		var errIncomplete *ErrorIncompleteRequest
+		require.True(t, errors.As(err, &errIncomplete), "Expected error for incomplete request")
+	})
+}
+
+func TestTrailersParse(t *testing.T) {
+	t.Run("declared trailers", func(t *testing.T) {
+		headers := []string{"Transfer-Encoding: chunked", "Trailer: X-Checksum, X-Length"}
+		body := "3\r\nabc\r\n0\r\nX-Checksum: 1234\r\nX-Length: 3\r\n\r\n"
+		r, err := RequestFromReader(NewChunkReader("POST", "/upload", "HTTP/1.1", headers, body, 3))
+		require.NoError(t, err)
+		assert.Equal(t, "1234", r.Trailers.Get("x-checksum"))
+		assert.Equal(t, "3", r.Trailers.Get("x-length"))
+		assert.Empty(t, r.Headers.Get("x-checksum"))
+	})
+
+	t.Run("no trailers", func(t *testing.T) {
+		r, err := RequestFromReader(NewChunkReader("GET", "/", "HTTP/1.1", []string{"Host: localhost:42069"}, "", 3))
+		require.NoError(t, err)
+		assert.Zero(t, r.Trailers.Len())
+	})
+
+	t.Run("undeclared trailer", func(t *testing.T) {
+		headers := []string{"Transfer-Encoding: chunked", "Trailer: X-Checksum"}
+		body := "0\r\nX-Other: 1\r\n\r\n"
+		_, err := RequestFromReader(NewChunkReader("POST", "/upload", "HTTP/1.1", headers, body, 3))
+		require.Error(t, err)
+		var errUndeclared *ErrorParsingTrailerUndeclaredField
+		require.True(t, errors.As(err, &errUndeclared), "Expected error for undeclared trailer")
+	})
+
+	t.Run("forbidden trailers", func(t *testing.T) {
+		for _, trailer := range []string{"Content-Length: 3", "Host: evil.example", "Transfer-Encoding: chunked"} {
+			body := "0\r\n" + trailer + "\r\n\r\n"
+			_, err := RequestFromReader(NewChunkReader("POST", "/upload", "HTTP/1.1", []string{"Transfer-Encoding: chunked"}, body, 3))
+			require.Error(t, err)
+			var errForbidden *ErrorParsingTrailerForbiddenField
+			require.True(t, errors.As(err, &errForbidden), "Trailer %s should be forbidden", trailer)
+		}
+	})
+
+	t.Run("malformed trailer", func(t *testing.T) {
+		body := "0\r\nX-Checksum 1234\r\n\r\n"
+		_, err := RequestFromReader(NewChunkReader("POST", "/upload", "HTTP/1.1", []string{"Transfer-Encoding: chunked"}, body, 3))
+		require.Error(t, err)
+		var errInvalidHeaderKV *headers.ErrorParsingHeaderKeyValuePairMissing
+		require.True(t, errors.As(err, &errInvalidHeaderKV), "Expected error for malformed trailer")
+	})
+}
+
+func TestReaderStreamBody(t *testing.T) {
+	t.Run("content-length body", func(t *testing.T) {
+		body := "Hello World!\n"
+		reader := NewReader(NewChunkReader("POST", "/test", "HTTP/1.1", []string{"Content-Length: 13"}, body, 3))
+		reader.StreamBody = true
+
+		r, err := reader.ReadRequest()
+		require.NoError(t, err)
+		assert.Nil(t, r.Body)
+
+		data, err := io.ReadAll(r.BodyReader)
+		require.NoError(t, err)
+		assert.Equal(t, []byte(body), data)
+	})
+
+	t.Run("chunked body with trailers", func(t *testing.T) {
+		body := "5\r\nHello\r\n8\r\n, World!\r\n0\r\nX-Checksum: 1234\r\n\r\n"
+		reader := NewReader(NewChunkReader("POST", "/test", "HTTP/1.1", []string{"Transfer-Encoding: chunked"}, body, 4))
+		reader.StreamBody = true
+
+		r, err := reader.ReadRequest()
+		require.NoError(t, err)
+		assert.Zero(t, r.Trailers.Len())
+
+		data, err := io.ReadAll(r.BodyReader)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("Hello, World!"), data)
+		assert.Equal(t, "1234", r.Trailers.Get("x-checksum"))
+	})
+
+	t.Run("headers returned before body arrives", func(t *testing.T) {
+		pr, pw := io.Pipe()
+		reader := NewReader(pr)
+		reader.StreamBody = true
+
+		go pw.Write([]byte("POST /test HTTP/1.1\r\nContent-Length: 5\r\n\r\n"))
+		r, err := reader.ReadRequest()
+		require.NoError(t, err)
+		assert.Equal(t, "/test", r.RequestLine.RequestTarget)
+
+		go pw.Write([]byte("hello"))
+		data, err := io.ReadAll(r.BodyReader)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("hello"), data)
+	})
+
+	t.Run("unread body drained before next request", func(t *testing.T) {
+		data := generateRequest("POST", "/first", "HTTP/1.1", "3\r\nabc\r\n0\r\n\r\n", []string{"Transfer-Encoding: chunked"}) +
+			generateRequest("POST", "/second", "HTTP/1.1", "hello", []string{"Content-Length: 5"}) +
+			generateRequest("GET", "/third", "HTTP/1.1", "", []string{"Host: localhost:42069"})
+		reader := NewReader(&chunkReader{data: data, numBytesPerRead: 5})
+		reader.StreamBody = true
+
+		r, err := reader.ReadRequest()
+		require.NoError(t, err)
+		assert.Equal(t, "/first", r.RequestLine.RequestTarget)
+
+		r, err = reader.ReadRequest()
+		require.NoError(t, err)
+		assert.Equal(t, "/second", r.RequestLine.RequestTarget)
+		buf := make([]byte, 2)
+		_, err = io.ReadFull(r.BodyReader, buf)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("he"), buf)
+
+		r, err = reader.ReadRequest()
+		require.NoError(t, err)
+		assert.Equal(t, "/third", r.RequestLine.RequestTarget)
+	})
+
+	t.Run("unread body drained up to a cap", func(t *testing.T) {
+		for size, drained := range map[int]bool{maxDrainBytes: true, maxDrainBytes + 1: false} {
+			data := generateRequest("POST", "/big", "HTTP/1.1", strings.Repeat("a", size), []string{"Content-Length: " + strconv.Itoa(size)})
+			reader := NewReader(strings.NewReader(data))
+			reader.StreamBody = true
+
+			r, err := reader.ReadRequest()
+			require.NoError(t, err)
+			err = r.BodyReader.Close()
+			if drained {
+				assert.NoError(t, err, size)
+				continue
+			}
+			var errTooLarge *ErrorBodyTooLargeToDrain
+			assert.True(t, errors.As(err, &errTooLarge), "Expected error for undrainable body, got %v", err)
+			_, err = reader.ReadRequest()
+			assert.Error(t, err)
+		}
+	})
+
+	t.Run("truncated body", func(t *testing.T) {
+		reader := NewReader(NewChunkReader("POST", "/test", "HTTP/1.1", []string{"Content-Length: 15"}, "Hello World!\n", 3))
+		reader.StreamBody = true
+
+		r, err := reader.ReadRequest()
+		require.NoError(t, err)
+
+		_, err = io.ReadAll(r.BodyReader)
+		require.Error(t, err)
+		var errInvalidBodySize *ErrorParsingBodyInvalidBodySize
+		require.True(t, errors.As(err, &errInvalidBodySize), "Expected error for invalid body size")
+		assert.Error(t, r.BodyReader.Close())
+	})
+}
+
+func TestReaderLimits(t *testing.T) {
+	limits := Limits{
+		MaxRequestLineLength: 32,
+		MaxHeaderBytes:       64,
+		MaxHeaderCount:       3,
+		MaxBodyBytes:         8,
+		MaxChunkLineLength:   16,
+	}
+	newReader := func(target string, headers []string, body string) *Reader {
+		reader := NewReader(NewChunkReader("POST", target, "HTTP/1.1", headers, body, 3))
+		reader.Limits = limits
+		return reader
+	}
+
+	t.Run("within limits", func(t *testing.T) {
+		r, err := newReader("/ok", []string{"Host: localhost", "Content-Length: 8"}, "12345678").ReadRequest()
+		require.NoError(t, err)
+		assert.Equal(t, []byte("12345678"), r.Body)
+	})
+
+	t.Run("request line too long", func(t *testing.T) {
+		_, err := newReader("/"+strings.Repeat("a", 32), []string{"Host: localhost"}, "").ReadRequest()
+		var errTooLong *ErrorParsingRequestLineTooLong
+		require.True(t, errors.As(err, &errTooLong), "Expected error for long request line, got %v", err)
+	})
+
+	t.Run("unterminated request line too long", func(t *testing.T) {
+		reader := NewReader(&chunkReader{data: strings.Repeat("A", 100), numBytesPerRead: 10})
+		reader.Limits = limits
+		_, err := reader.ReadRequest()
+		var errTooLong *ErrorParsingRequestLineTooLong
+		require.True(t, errors.As(err, &errTooLong), "Expected error for long request line, got %v", err)
+	})
+
+	t.Run("header bytes too large", func(t *testing.T) {
+		_, err := newReader("/", []string{"X-Big: " + strings.Repeat("a", 64)}, "").ReadRequest()
+		var errTooLarge *ErrorParsingHeadersTooLarge
+		require.True(t, errors.As(err, &errTooLarge), "Expected error for large headers, got %v", err)
+	})
+
+	t.Run("too many headers", func(t *testing.T) {
+		_, err := newReader("/", []string{"A: 1", "B: 2", "C: 3", "D: 4"}, "").ReadRequest()
+		var errTooMany *ErrorParsingHeadersTooMany
+		require.True(t, errors.As(err, &errTooMany), "Expected error for too many headers, got %v", err)
+	})
+
+	t.Run("content-length too large", func(t *testing.T) {
+		_, err := newReader("/", []string{"Content-Length: 9"}, "123456789").ReadRequest()
+		var errTooLarge *ErrorParsingBodyTooLarge
+		require.True(t, errors.As(err, &errTooLarge), "Expected error for large body, got %v", err)
+	})
+
+	t.Run("chunked body too large", func(t *testing.T) {
+		_, err := newReader("/", []string{"Transfer-Encoding: chunked"}, "5\r\n12345\r\n4\r\n6789\r\n0\r\n\r\n").ReadRequest()
+		var errTooLarge *ErrorParsingBodyTooLarge
+		require.True(t, errors.As(err, &errTooLarge), "Expected error for large body, got %v", err)
+	})
+
+	t.Run("chunk-size line too long", func(t *testing.T) {
+		_, err := newReader("/", []string{"Transfer-Encoding: chunked"}, "1;ext="+strings.Repeat("a", 16)+"\r\nx\r\n0\r\n\r\n").ReadRequest()
+		var errTooLong *ErrorParsingBodyChunkLineTooLong
+		require.True(t, errors.As(err, &errTooLong), "Expected error for long chunk-size line, got %v", err)
+	})
+
+	t.Run("unterminated chunk-size line too long", func(t *testing.T) {
+		_, err := newReader("/", []string{"Transfer-Encoding: chunked"}, "1"+strings.Repeat(";", 100)).ReadRequest()
+		var errTooLong *ErrorParsingBodyChunkLineTooLong
+		require.True(t, errors.As(err, &errTooLong), "Expected error for long chunk-size line, got %v", err)
+	})
+}
+
+func TestRequestTargetParse(t *testing.T) {
+	t.Run("origin form", func(t *testing.T) {
+		r, err := RequestFromReader(NewChunkReader("GET", "/search/caf%C3%A9%2Fbar?q=a+b&tag=x&tag=y#top", "HTTP/1.1", []string{"Host: localhost:42069"}, "", 3))
+		require.NoError(t, err)
+		assert.Equal(t, TargetFormOrigin, r.Target.Form)
+		assert.Equal(t, "/search/café/bar", r.Target.Path)
+		assert.Equal(t, "/search/caf%C3%A9%2Fbar", r.Target.RawPath)
+		assert.Equal(t, "q=a+b&tag=x&tag=y", r.Target.RawQuery)
+		assert.Equal(t, "a b", r.Target.Query.Get("q"))
+		assert.Equal(t, []string{"x", "y"}, r.Target.Query["tag"])
+		assert.Equal(t, "top", r.Target.Fragment)
+	})
+
+	t.Run("absolute form", func(t *testing.T) {
+		target, err := ParseTarget(MethodGet, "HTTP://example.com:8080/a%20b?x=1")
+		require.NoError(t, err)
+		assert.Equal(t, TargetFormAbsolute, target.Form)
+		assert.Equal(t, "http", target.Scheme)
+		assert.Equal(t, "example.com:8080", target.Host)
+		assert.Equal(t, "/a b", target.Path)
+		assert.Equal(t, "1", target.Query.Get("x"))
+
+		target, err = ParseTarget(MethodGet, "http://example.com?x=1")
+		require.NoError(t, err)
+		assert.Equal(t, "/", target.Path)
+		assert.Equal(t, "x=1", target.RawQuery)
+	})
+
+	t.Run("malformed queries", func(t *testing.T) {
+		target, err := ParseTarget(MethodGet, "/search?a=1;b=2&c=3")
+		require.NoError(t, err)
+		assert.Equal(t, "a=1;b=2&c=3", target.RawQuery)
+		assert.Equal(t, "3", target.Query.Get("c"))
+
+		target, err = ParseTarget(MethodGet, "/search?q=100%")
+		require.NoError(t, err)
+		assert.Equal(t, "q=100%", target.RawQuery)
+		assert.NotNil(t, target.Query)
+
+		_, err = ParseTarget(MethodGet, "/search%zz?q=1")
+		var errInvalidTarget *ErrorParsingRequestInvalidTarget
+		assert.True(t, errors.As(err, &errInvalidTarget), "Malformed path should be invalid")
+	})
+
+	t.Run("authority form", func(t *testing.T) {
+		target, err := ParseTarget(MethodConnect, "example.com:443")
+		require.NoError(t, err)
+		assert.Equal(t, TargetFormAuthority, target.Form)
+		assert.Equal(t, "example.com:443", target.Host)
+
+		for _, raw := range []string{"/path", "example.com", "example.com:https", ":443"} {
+			_, err := ParseTarget(MethodConnect, raw)
+			var errInvalidTarget *ErrorParsingRequestInvalidTarget
+			require.True(t, errors.As(err, &errInvalidTarget), "Target %s should be invalid for CONNECT", raw)
+		}
+	})
+
+	t.Run("asterisk form", func(t *testing.T) {
+		r, err := RequestFromReader(NewChunkReader("OPTIONS", "*", "HTTP/1.1", []string{"Host: localhost:42069"}, "", 3))
+		require.NoError(t, err)
+		assert.Equal(t, TargetFormAsterisk, r.Target.Form)
+		assert.Equal(t, "*", r.Target.Path)
+	})
+}
+
+func TestReaderObsFold(t *testing.T) {
+	raw := "GET / HTTP/1.1\r\nHost: localhost:42069\r\nX-Long: first\r\n second\r\n\r\n"
+
+	t.Run("rejected by default", func(t *testing.T) {
+		_, err := NewReader(strings.NewReader(raw)).ReadRequest()
+		var target *headers.ErrorParsingHeaderObsFold
+		assert.ErrorAs(t, err, &target)
+	})
+
+	t.Run("replaced when configured", func(t *testing.T) {
+		reader := NewReader(strings.NewReader(raw))
+		reader.ObsFold = headers.ObsFoldReplace
+		r, err := reader.ReadRequest()
+		require.NoError(t, err)
+		assert.Equal(t, "first second", r.Headers.Get("x-long"))
+	})
+}
+
+func TestRequestFraming(t *testing.T) {
+	read := func(raw string) (*Request, error) {
+		return NewReader(strings.NewReader(raw)).ReadRequest()
+	}
+
+	t.Run("smuggling payloads are rejected", func(t *testing.T) {
+		payloads := map[string]string{
+			"CL.TE": "POST / HTTP/1.1\r\nHost: a\r\nContent-Length: 13\r\nTransfer-Encoding: chunked\r\n\r\n" +
+				"0\r\n\r\nSMUGGLED",
+			"TE.CL": "POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding: chunked\r\nContent-Length: 3\r\n\r\n" +
+				"8\r\nSMUGGLED\r\n0\r\n\r\n",
+			"TE.TE with an obfuscated duplicate": "POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding: chunked\r\n" +
+				"Transfer-Encoding: x\r\n\r\n0\r\n\r\n",
+			"chunked not final": "POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding: chunked, identity\r\n\r\n0\r\n\r\n",
+			"chunked twice":     "POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding: chunked, chunked\r\n\r\n0\r\n\r\n",
+			"misspelled chunked": "POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding: xchunked\r\n\r\n" +
+				"0\r\n\r\n",
+			"empty transfer coding":      "POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding: ,chunked\r\n\r\n0\r\n\r\n",
+			"empty transfer encoding":    "POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding:\r\n\r\n",
+			"HTTP/1.0 transfer encoding": "POST / HTTP/1.0\r\nHost: a\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n",
+			"differing duplicate lengths": "POST / HTTP/1.1\r\nHost: a\r\nContent-Length: 5\r\nContent-Length: 6\r\n\r\n" +
+				"hello!",
+			"differing listed lengths": "POST / HTTP/1.1\r\nHost: a\r\nContent-Length: 5, 6\r\n\r\nhello!",
+			"negative length":          "POST / HTTP/1.1\r\nHost: a\r\nContent-Length: -5\r\n\r\nhello",
+			"signed length":            "POST / HTTP/1.1\r\nHost: a\r\nContent-Length: +5\r\n\r\nhello",
+			"hexadecimal length":       "POST / HTTP/1.1\r\nHost: a\r\nContent-Length: 0x5\r\n\r\nhello",
+			"spaced length":            "POST / HTTP/1.1\r\nHost: a\r\nContent-Length: 5 5\r\n\r\nhello",
+			"empty length":             "POST / HTTP/1.1\r\nHost: a\r\nContent-Length:\r\n\r\n",
+		}
+		for name, raw := range payloads {
+			_, err := read(raw)
+			var target *ErrorParsingRequestAmbiguousFraming
+			assert.ErrorAs(t, err, &target, name)
+		}
+	})
+
+	t.Run("obfuscated header lines are rejected", func(t *testing.T) {
+		payloads := map[string]string{
+			"space before colon": "POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding : chunked\r\nContent-Length: 3\r\n\r\nabc",
+			"folded value":       "POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding:\r\n chunked\r\nContent-Length: 3\r\n\r\nabc",
+			"vertical tab":       "POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding: \x0bchunked\r\nContent-Length: 3\r\n\r\nabc",
+			"whitespace line":    "POST / HTTP/1.1\r\nHost: a\r\nX-A: b\r\n \r\nContent-Length: 5\r\n\r\nhello",
+		}
+		for name, raw := range payloads {
+			_, err := read(raw)
+			assert.Error(t, err, name)
+		}
+	})
+
+	t.Run("unsupported transfer codings", func(t *testing.T) {
+		_, err := read("POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding: gzip, chunked\r\n\r\n0\r\n\r\n")
+		var target *ErrorParsingRequestUnsupportedTransferCoding
+		require.ErrorAs(t, err, &target)
+		assert.Equal(t, "gzip", target.Coding)
+	})
+
+	t.Run("unambiguous framing is accepted", func(t *testing.T) {
+		r, err := read("POST / HTTP/1.1\r\nHost: a\r\nContent-Length: 5\r\nContent-Length: 5\r\n\r\nhello")
+		require.NoError(t, err)
+		assert.Equal(t, "hello", string(r.Body))
+
+		r, err = read("POST / HTTP/1.1\r\nHost: a\r\nContent-Length: 5, 5\r\n\r\nhello")
+		require.NoError(t, err)
+		assert.Equal(t, "hello", string(r.Body))
+
+		r, err = read("POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding: CHUNKED\r\n\r\n5\r\nhello\r\n0\r\n\r\n")
+		require.NoError(t, err)
+		assert.Equal(t, "hello", string(r.Body))
+
+		r, err = read("POST / HTTP/1.1\r\nHost: a\r\nContent-Length: 0\r\n\r\n")
+		require.NoError(t, err)
+		assert.Empty(t, r.Body)
+	})
+}
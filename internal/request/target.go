@@ -0,0 +1,126 @@
+package request
+
+import (
+	"net"
+	"net/url"
+	"strings"
+)
+
+type TargetForm int
+
+const (
+	// TargetFormOrigin is an absolute path with an optional query: "/a?b=c".
+	TargetFormOrigin TargetForm = iota
+	// TargetFormAbsolute is a full URI, as sent to proxies: "http://h/a".
+	TargetFormAbsolute
+	// TargetFormAuthority is the "host:port" sent with CONNECT.
+	TargetFormAuthority
+	// TargetFormAsterisk is the "*" sent with a server-wide OPTIONS.
+	TargetFormAsterisk
+)
+
+// Target is the parsed request-target. Path is percent-decoded; RawPath keeps
+// the bytes as sent so encoded slashes can still be told apart. Query holds
+// the pairs of RawQuery that could be decoded.
+type Target struct {
+	Form     TargetForm
+	Scheme   string
+	Host     string
+	Path     string
+	RawPath  string
+	RawQuery string
+	Query    url.Values
+	Fragment string
+}
+
+// ParseTarget parses raw in whichever of the four RFC 9112 forms is allowed
+// for method: authority-form only for CONNECT, asterisk-form only for
+// OPTIONS, and origin- or absolute-form otherwise.
+func ParseTarget(method, raw string) (*Target, error) {
+	invalid := &ErrorParsingRequestInvalidTarget{Target: raw}
+	if raw == "" || strings.ContainsFunc(raw, isControlOrSpace) {
+		return nil, invalid
+	}
+
+	switch {
+	case method == MethodConnect:
+		host, port, err := net.SplitHostPort(raw)
+		if err != nil || host == "" || port == "" || strings.Trim(port, "0123456789") != "" {
+			return nil, invalid
+		}
+		return &Target{Form: TargetFormAuthority, Host: raw, Query: url.Values{}}, nil
+	case raw == "*":
+		if method != MethodOptions {
+			return nil, invalid
+		}
+		return &Target{Form: TargetFormAsterisk, Path: "*", RawPath: "*", Query: url.Values{}}, nil
+	case strings.HasPrefix(raw, "/"):
+		target := &Target{Form: TargetFormOrigin}
+		if err := target.parsePathAndQuery(raw); err != nil {
+			return nil, invalid
+		}
+		return target, nil
+	default:
+		scheme, rest, found := strings.Cut(raw, "://")
+		if !found || !isValidScheme(scheme) {
+			return nil, invalid
+		}
+		hostEnd := strings.IndexAny(rest, "/?#")
+		if hostEnd == -1 {
+			hostEnd = len(rest)
+		}
+		target := &Target{
+			Form:   TargetFormAbsolute,
+			Scheme: strings.ToLower(scheme),
+			Host:   rest[:hostEnd],
+		}
+		if target.Host == "" {
+			return nil, invalid
+		}
+		pathAndQuery := rest[hostEnd:]
+		if !strings.HasPrefix(pathAndQuery, "/") {
+			pathAndQuery = "/" + pathAndQuery
+		}
+		if err := target.parsePathAndQuery(pathAndQuery); err != nil {
+			return nil, invalid
+		}
+		return target, nil
+	}
+}
+
+func (t *Target) parsePathAndQuery(s string) error {
+	s, t.Fragment, _ = strings.Cut(s, "#")
+	t.RawPath, t.RawQuery, _ = strings.Cut(s, "?")
+
+	path, err := url.PathUnescape(t.RawPath)
+	if err != nil {
+		return err
+	}
+	t.Path = path
+
+	// A malformed pair such as "q=100%" is left out of Query rather than
+	// failing the request; handlers that care can still read RawQuery.
+	t.Query, _ = url.ParseQuery(t.RawQuery)
+	return nil
+}
+
+func isValidScheme(scheme string) bool {
+	if scheme == "" || !isAlpha(scheme[0]) {
+		return false
+	}
+	for i := 1; i < len(scheme); i++ {
+		c := scheme[i]
+		if !isAlpha(c) && !isDigit(c) && c != '+' && c != '-' && c != '.' {
+			return false
+		}
+	}
+	return true
+}
+
+func isAlpha(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isControlOrSpace(r rune) bool {
+	return r <= ' ' || r == 0x7f
+}
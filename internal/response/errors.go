@@ -10,6 +10,14 @@ func (e *ErrorInvalidStatusCode) Error() string {
 	return fmt.Sprintf("error: invalid status code: %d", e.StatusCode)
 }
 
+type ErrorInvalidReasonPhrase struct {
+	ReasonPhrase string
+}
+
+func (e *ErrorInvalidReasonPhrase) Error() string {
+	return fmt.Sprintf("error: invalid reason phrase: %q", e.ReasonPhrase)
+}
+
 type ErrorWritingStatusLine struct {
 	Err error
 }
@@ -34,6 +42,14 @@ func (e *ErrorWritingBody) Error() string {
 	return fmt.Sprintf("error: writing body: %v", e.Err)
 }
 
+type ErrorBodyTooLong struct {
+	ContentLength int
+}
+
+func (e *ErrorBodyTooLong) Error() string {
+	return fmt.Sprintf("error: body longer than content length %d", e.ContentLength)
+}
+
 type ErrorWritingChunkedBody struct {
 	Err error
 }
@@ -42,11 +58,27 @@ func (e *ErrorWritingChunkedBody) Error() string {
 	return fmt.Sprintf("error: writing chunked body: %v", e.Err)
 }
 
+type ErrorWritingTrailers struct {
+	Err error
+}
+
+func (e *ErrorWritingTrailers) Error() string {
+	return fmt.Sprintf("error: writing trailers: %v", e.Err)
+}
+
+type ErrorUndeclaredTrailer struct {
+	Field string
+}
+
+func (e *ErrorUndeclaredTrailer) Error() string {
+	return fmt.Sprintf("error: trailer %s not declared in Trailer header", e.Field)
+}
+
 type ErrorInvalidWriterState struct {
 	CurrentState  writerState
 	ExpectedState writerState
 }
 
 func (e *ErrorInvalidWriterState) Error() string {
-	return fmt.Sprintf("error: invalid writer state: current=%d, expected=%d", e.CurrentState, e.ExpectedState)
+	return fmt.Sprintf("error: invalid writer state: current=%s, expected=%s", e.CurrentState, e.ExpectedState)
 }
@@ -7,40 +7,42 @@ import (
 	"github.com/DimRev/httpfromtcp/internal/headers"
 )
 
-type StatusCode int
-
-const (
-	StatusOK                  StatusCode = 200
-	StatusBadRequest          StatusCode = 400
-	StatusInternalServerError StatusCode = 500
-)
-
 const CRLF = "\r\n"
 
-func getStatusLine(statusCode StatusCode) []byte {
-	reasonPhrase := ""
-	switch statusCode {
-	case StatusOK:
-		reasonPhrase = "OK"
-	case StatusBadRequest:
-		reasonPhrase = "Bad Request"
-	case StatusInternalServerError:
-		reasonPhrase = "Internal Server Error"
+func getStatusLine(httpVersion string, statusCode StatusCode, reasonPhrase string) []byte {
+	return []byte(fmt.Sprintf("HTTP/%s %d %s\r\n", httpVersion, statusCode, reasonPhrase))
+}
+
+// checkStatusLine validates the parts of a status line before it is written.
+func checkStatusLine(statusCode StatusCode, reasonPhrase string) error {
+	if !validStatusCode(statusCode) {
+		return &ErrorInvalidStatusCode{StatusCode: int(statusCode)}
 	}
-	return []byte(fmt.Sprintf("HTTP/1.1 %d %s\r\n", statusCode, reasonPhrase))
+	if !validReasonPhrase(reasonPhrase) {
+		return &ErrorInvalidReasonPhrase{ReasonPhrase: reasonPhrase}
+	}
+	return nil
 }
 
 func WriteStatusLine(w io.Writer, statusCode StatusCode) error {
-	_, err := w.Write(getStatusLine(statusCode))
+	return WriteStatusLineWithReason(w, statusCode, StatusText(statusCode))
+}
+
+// WriteStatusLineWithReason writes a status line with a custom reason
+// phrase in place of the registered one.
+func WriteStatusLineWithReason(w io.Writer, statusCode StatusCode, reasonPhrase string) error {
+	if err := checkStatusLine(statusCode, reasonPhrase); err != nil {
+		return err
+	}
+	_, err := w.Write(getStatusLine("1.1", statusCode, reasonPhrase))
 	return err
 }
 
-func GetDefaultHeaders(contentLen int) headers.Headers {
+func GetDefaultHeaders(contentLen int) *headers.Headers {
 	h := headers.NewHeaders()
 
-	h.Replace("Content-Length", fmt.Sprintf("%d", contentLen))
-	h.Replace("Content-Type", "text/plain")
-	h.Replace("Connection", "close")
+	h.Set("Content-Length", fmt.Sprintf("%d", contentLen))
+	h.Set("Content-Type", "text/plain")
 
 	return h
 }
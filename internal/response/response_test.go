@@ -0,0 +1,401 @@
+package response
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/DimRev/httpfromtcp/internal/headers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatusLine(t *testing.T) {
+	t.Run("registered reason phrases", func(t *testing.T) {
+		for statusCode, want := range map[StatusCode]string{
+			StatusOK:                            "HTTP/1.1 200 OK\r\n",
+			StatusNotFound:                      "HTTP/1.1 404 Not Found\r\n",
+			StatusTooManyRequests:               "HTTP/1.1 429 Too Many Requests\r\n",
+			StatusNetworkAuthenticationRequired: "HTTP/1.1 511 Network Authentication Required\r\n",
+		} {
+			var buf bytes.Buffer
+			require.NoError(t, WriteStatusLine(&buf, statusCode))
+			assert.Equal(t, want, buf.String())
+		}
+	})
+
+	t.Run("unregistered codes have an empty reason phrase", func(t *testing.T) {
+		assert.Equal(t, "", StatusText(599))
+		var buf bytes.Buffer
+		require.NoError(t, WriteStatusLine(&buf, 599))
+		assert.Equal(t, "HTTP/1.1 599 \r\n", buf.String())
+	})
+
+	t.Run("custom reason phrases", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		w.SetHttpVersion("1.0")
+		require.NoError(t, w.WriteStatusLineWithReason(StatusOK, "Fine\tThanks"))
+		assert.Equal(t, "HTTP/1.0 200 Fine\tThanks\r\n", buf.String())
+		assert.Equal(t, StatusOK, w.StatusCode())
+	})
+
+	t.Run("invalid status codes", func(t *testing.T) {
+		for _, statusCode := range []StatusCode{0, 99, 1000, -200} {
+			var buf bytes.Buffer
+			w := NewWriter(&buf)
+			err := w.WriteStatusLine(statusCode)
+			var target *ErrorInvalidStatusCode
+			require.ErrorAs(t, err, &target)
+			assert.Equal(t, int(statusCode), target.StatusCode)
+			assert.Empty(t, buf.String())
+			assert.False(t, w.Started())
+		}
+	})
+
+	t.Run("invalid reason phrases", func(t *testing.T) {
+		for _, reasonPhrase := range []string{"OK\r\nSet-Cookie: a=b", "bad\x00", "del\x7f"} {
+			var buf bytes.Buffer
+			err := WriteStatusLineWithReason(&buf, StatusOK, reasonPhrase)
+			var target *ErrorInvalidReasonPhrase
+			assert.ErrorAs(t, err, &target)
+			assert.Empty(t, buf.String())
+		}
+	})
+}
+
+func TestWriterImplicitFraming(t *testing.T) {
+	t.Run("small bodies get a content length", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		w.Header().Set("Content-Type", "application/json")
+		require.NoError(t, json.NewEncoder(w).Encode(map[string]int{"a": 1}))
+		assert.Empty(t, buf.String())
+		require.NoError(t, w.Finish())
+
+		resp := buf.String()
+		assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 200 OK\r\n"))
+		assert.Contains(t, resp, "Content-Length: 8\r\n")
+		assert.Contains(t, resp, "Content-Type: application/json\r\n")
+		assert.True(t, strings.HasSuffix(resp, "\r\n\r\n{\"a\":1}\n"))
+		assert.Equal(t, StatusOK, w.StatusCode())
+	})
+
+	t.Run("large bodies switch to chunked", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		w.SetBufferSize(4)
+		_, err := io.Copy(w, strings.NewReader("hello world"))
+		require.NoError(t, err)
+		require.NoError(t, w.Finish())
+
+		resp := buf.String()
+		assert.Contains(t, resp, "Transfer-Encoding: chunked\r\n")
+		assert.NotContains(t, resp, "Content-Length")
+		assert.True(t, strings.HasSuffix(resp, "\r\n\r\nb\r\nhello world\r\n0\r\n\r\n"))
+	})
+
+	t.Run("empty writes do not end a chunked body", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		w.SetBufferSize(4)
+		_, err := io.WriteString(w, "hello world")
+		require.NoError(t, err)
+		n, err := w.Write(nil)
+		require.NoError(t, err)
+		assert.Equal(t, 0, n)
+		n, err = w.WriteChunkedBody([]byte{})
+		require.NoError(t, err)
+		assert.Equal(t, 0, n)
+		require.NoError(t, w.Finish())
+
+		resp := buf.String()
+		assert.True(t, strings.HasSuffix(resp, "\r\n\r\nb\r\nhello world\r\n0\r\n\r\n"))
+		assert.Equal(t, 1, strings.Count(resp, "0\r\n\r\n"))
+	})
+
+	t.Run("small bodies keep requested chunking", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		w.SetKeepAlive(true)
+		w.Header().Set("Transfer-Encoding", "chunked")
+		_, err := io.WriteString(w, "hi")
+		require.NoError(t, err)
+		require.NoError(t, w.Finish())
+
+		resp := buf.String()
+		assert.Contains(t, resp, "Transfer-Encoding: chunked\r\n")
+		assert.NotContains(t, resp, "Content-Length")
+		assert.True(t, strings.HasSuffix(resp, "\r\n\r\n2\r\nhi\r\n0\r\n\r\n"))
+		assert.True(t, w.KeepAlive())
+	})
+
+	t.Run("explicit status line", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		require.NoError(t, w.WriteStatusLine(StatusCreated))
+		_, err := io.WriteString(w, "made")
+		require.NoError(t, err)
+		require.NoError(t, w.Finish())
+
+		resp := buf.String()
+		assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 201 Created\r\n"))
+		assert.Contains(t, resp, "Content-Length: 4\r\n")
+		assert.True(t, strings.HasSuffix(resp, "made"))
+	})
+
+	t.Run("flush streams what is buffered", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		_, err := io.WriteString(w, "tick")
+		require.NoError(t, err)
+		require.NoError(t, w.Flush())
+		assert.True(t, strings.HasSuffix(buf.String(), "4\r\ntick\r\n"))
+
+		_, err = io.WriteString(w, "tock")
+		require.NoError(t, err)
+		require.NoError(t, w.Finish())
+		assert.True(t, strings.HasSuffix(buf.String(), "4\r\ntick\r\n4\r\ntock\r\n0\r\n\r\n"))
+	})
+
+	t.Run("writes after explicit headers", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		require.NoError(t, w.WriteStatusLine(StatusOK))
+		require.NoError(t, w.WriteHeaders(GetDefaultHeaders(5)))
+		_, err := io.WriteString(w, "hello")
+		require.NoError(t, err)
+		require.NoError(t, w.Finish())
+		assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\nhello"))
+	})
+
+	t.Run("HEAD responses keep the length but not the body", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		w.SetOmitBody(true)
+		_, err := io.WriteString(w, "hello")
+		require.NoError(t, err)
+		require.NoError(t, w.Finish())
+
+		resp := buf.String()
+		assert.Contains(t, resp, "Content-Length: 5\r\n")
+		assert.True(t, strings.HasSuffix(resp, "\r\n\r\n"))
+	})
+
+	t.Run("HTTP/1.0 responses are close-delimited", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		w.SetHttpVersion("1.0")
+		w.SetBufferSize(4)
+		_, err := io.WriteString(w, "hello world")
+		require.NoError(t, err)
+		require.NoError(t, w.Finish())
+
+		resp := buf.String()
+		assert.NotContains(t, resp, "Transfer-Encoding")
+		assert.Contains(t, resp, "Connection: close\r\n")
+		assert.True(t, strings.HasSuffix(resp, "\r\n\r\nhello world"))
+	})
+
+	t.Run("an explicit status line discards buffered writes", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		_, err := io.WriteString(w, "partial")
+		require.NoError(t, err)
+		assert.False(t, w.Started())
+
+		require.NoError(t, w.WriteStatusLine(StatusInternalServerError))
+		require.NoError(t, w.WriteHeaders(GetDefaultHeaders(4)))
+		_, err = w.WriteBody([]byte("oops"))
+		require.NoError(t, err)
+		require.NoError(t, w.Finish())
+		assert.NotContains(t, buf.String(), "partial")
+	})
+}
+
+func TestWriterTrailers(t *testing.T) {
+	// start returns a writer whose chunked headers announce trailer.
+	start := func(t *testing.T, buf *bytes.Buffer, trailer string) *Writer {
+		t.Helper()
+		w := NewWriter(buf)
+		h := headers.NewHeaders()
+		h.Set("Transfer-Encoding", "chunked")
+		if trailer != "" {
+			h.Set("Trailer", trailer)
+		}
+		require.NoError(t, w.WriteStatusLine(StatusOK))
+		require.NoError(t, w.WriteHeaders(h))
+		return w
+	}
+
+	t.Run("declared trailers", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := start(t, &buf, "X-Content-SHA256, X-Content-Length")
+		_, err := w.WriteChunkedBody([]byte("hello"))
+		require.NoError(t, err)
+
+		trailers := headers.NewHeaders()
+		trailers.Set("X-Content-Length", "5")
+		require.NoError(t, w.WriteTrailers(trailers))
+		assert.True(t, strings.HasSuffix(buf.String(), "5\r\nhello\r\n0\r\nX-Content-Length: 5\r\n\r\n"))
+
+		_, err = w.WriteChunkedBody([]byte("more"))
+		var target *ErrorInvalidWriterState
+		assert.ErrorAs(t, err, &target)
+	})
+
+	t.Run("no trailers", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := start(t, &buf, "")
+		require.NoError(t, w.WriteTrailers(headers.NewHeaders()))
+		assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\n0\r\n\r\n"))
+	})
+
+	t.Run("undeclared trailers", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := start(t, &buf, "X-Content-Length")
+		trailers := headers.NewHeaders()
+		trailers.Set("X-Other", "1")
+		err := w.WriteTrailers(trailers)
+		var target *ErrorUndeclaredTrailer
+		require.ErrorAs(t, err, &target)
+		assert.Equal(t, "X-Other", target.Field)
+	})
+
+	t.Run("trailers need a chunked body", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		require.NoError(t, w.WriteStatusLine(StatusOK))
+		require.NoError(t, w.WriteHeaders(GetDefaultHeaders(0)))
+		err := w.WriteTrailers(headers.NewHeaders())
+		var target *ErrorInvalidWriterState
+		assert.ErrorAs(t, err, &target)
+	})
+
+	t.Run("HTTP/1.0 responses drop trailers", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		w.SetHttpVersion("1.0")
+		h := headers.NewHeaders()
+		h.Set("Transfer-Encoding", "chunked")
+		h.Set("Trailer", "X-Content-Length")
+		require.NoError(t, w.WriteStatusLine(StatusOK))
+		require.NoError(t, w.WriteHeaders(h))
+		_, err := w.WriteChunkedBody([]byte("hello"))
+		require.NoError(t, err)
+
+		trailers := headers.NewHeaders()
+		trailers.Set("X-Content-Length", "5")
+		require.NoError(t, w.WriteTrailers(trailers))
+		assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\nhello"))
+	})
+}
+
+func TestWriterStates(t *testing.T) {
+	chunkedHeaders := func() *headers.Headers {
+		h := headers.NewHeaders()
+		h.Set("Transfer-Encoding", "chunked")
+		return h
+	}
+
+	t.Run("chunked bodies", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		w.SetKeepAlive(true)
+		require.NoError(t, w.WriteStatusLine(StatusOK))
+		require.NoError(t, w.WriteHeaders(chunkedHeaders()))
+
+		_, err := w.WriteBody([]byte("hello"))
+		var target *ErrorInvalidWriterState
+		require.ErrorAs(t, err, &target)
+		assert.Equal(t, "error: invalid writer state: current=chunked body, expected=body", err.Error())
+
+		_, err = w.WriteChunkedBody([]byte("hello"))
+		require.NoError(t, err)
+		assert.False(t, w.KeepAlive())
+		_, err = w.WriteChunkedBodyDone()
+		require.NoError(t, err)
+		assert.True(t, w.KeepAlive())
+
+		_, err = w.WriteChunkedBody([]byte("more"))
+		assert.ErrorAs(t, err, &target)
+		_, err = w.WriteChunkedBodyDone()
+		assert.ErrorAs(t, err, &target)
+	})
+
+	t.Run("fixed-length bodies", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		require.NoError(t, w.WriteStatusLine(StatusOK))
+		require.NoError(t, w.WriteHeaders(GetDefaultHeaders(5)))
+
+		var target *ErrorInvalidWriterState
+		_, err := w.WriteChunkedBody([]byte("hello"))
+		assert.ErrorAs(t, err, &target)
+		_, err = w.WriteChunkedBodyDone()
+		assert.ErrorAs(t, err, &target)
+
+		_, err = w.WriteBody([]byte("hello"))
+		require.NoError(t, err)
+		_, err = w.WriteBody([]byte("hello"))
+		assert.ErrorAs(t, err, &target)
+	})
+
+	t.Run("bodies must match the content length", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		w.SetKeepAlive(true)
+		require.NoError(t, w.WriteStatusLine(StatusOK))
+		require.NoError(t, w.WriteHeaders(GetDefaultHeaders(10)))
+		_, err := w.WriteBody([]byte("hi"))
+		require.NoError(t, err)
+		assert.False(t, w.KeepAlive())
+
+		w.Reset(&buf)
+		w.SetKeepAlive(true)
+		require.NoError(t, w.WriteStatusLine(StatusOK))
+		require.NoError(t, w.WriteHeaders(GetDefaultHeaders(2)))
+		_, err = w.WriteBody([]byte("hello"))
+		var target *ErrorBodyTooLong
+		require.ErrorAs(t, err, &target)
+		assert.False(t, w.KeepAlive())
+	})
+
+	t.Run("writes stop at the content length", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		w.SetKeepAlive(true)
+		require.NoError(t, w.WriteStatusLine(StatusOK))
+		require.NoError(t, w.WriteHeaders(GetDefaultHeaders(5)))
+
+		_, err := io.WriteString(w, "hel")
+		require.NoError(t, err)
+		assert.False(t, w.KeepAlive())
+		_, err = io.WriteString(w, "lo!")
+		var tooLong *ErrorBodyTooLong
+		require.ErrorAs(t, err, &tooLong)
+		_, err = io.WriteString(w, "lo")
+		require.NoError(t, err)
+		assert.True(t, w.KeepAlive())
+		assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\nhello"))
+	})
+
+	t.Run("reset", func(t *testing.T) {
+		var first, second bytes.Buffer
+		w := NewWriter(&first)
+		w.SetHttpVersion("1.0")
+		w.OnWriteHeaders(func(h *headers.Headers) { h.Set("X-Hook", "1") })
+		require.NoError(t, w.WriteStatusLine(StatusOK))
+		require.NoError(t, w.WriteHeaders(GetDefaultHeaders(0)))
+
+		w.Reset(&second)
+		assert.False(t, w.Started())
+		assert.Equal(t, StatusCode(0), w.StatusCode())
+		require.NoError(t, w.WriteStatusLine(StatusNotFound))
+		require.NoError(t, w.WriteHeaders(GetDefaultHeaders(0)))
+		assert.True(t, strings.HasPrefix(second.String(), "HTTP/1.1 404 Not Found\r\n"))
+		assert.NotContains(t, second.String(), "X-Hook")
+	})
+}
@@ -0,0 +1,156 @@
+package response
+
+import (
+	"strconv"
+
+	"github.com/DimRev/httpfromtcp/internal/headers"
+)
+
+// SetBufferSize sets how many body bytes Write buffers before giving up on
+// Content-Length and switching to chunked encoding.
+func (w *Writer) SetBufferSize(size int) {
+	w.bufferSize = size
+}
+
+// Header returns the headers sent when Write starts the response. Changes
+// made after the first Flush, or after the buffer fills, are not sent.
+func (w *Writer) Header() *headers.Headers {
+	if w.header == nil {
+		w.header = headers.NewHeaders()
+	}
+	return w.header
+}
+
+// Write implements io.Writer. If the status line has not been written, the
+// response is a 200. The body is buffered so small responses go out with a
+// Content-Length; once it outgrows the buffer, the headers are sent with
+// chunked encoding and the body is streamed. Handlers that use Write must
+// have Finish called once they return, which the server does.
+//
+// After an explicit WriteHeaders, Write sends body bytes directly, as chunks
+// if the headers asked for chunked encoding.
+func (w *Writer) Write(p []byte) (int, error) {
+	switch w.writerState {
+	case writerStateStatusLine, writerStateHeaders:
+		w.implicit = true
+		w.buf = append(w.buf, p...)
+		if len(w.buf) > w.bufferSize {
+			if err := w.Flush(); err != nil {
+				return 0, err
+			}
+		}
+		return len(p), nil
+	case writerStateChunkedBody:
+		if len(p) == 0 {
+			return 0, nil
+		}
+		if _, err := w.WriteChunkedBody(p); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	case writerStateBody:
+		return w.writeFixedBody(p)
+	default:
+		return 0, &ErrorInvalidWriterState{CurrentState: w.writerState, ExpectedState: writerStateBody}
+	}
+}
+
+// Flush sends the status line, headers and any buffered body written with
+// Write, committing the response to chunked encoding unless Header() sets a
+// Content-Length. It does nothing once the headers are written.
+func (w *Writer) Flush() error {
+	if !w.implicit || w.writerState > writerStateHeaders {
+		return nil
+	}
+	h := w.Header()
+	if h.Get("content-length") == "" {
+		h.Set("Transfer-Encoding", "chunked")
+	}
+	buf := w.buf
+	w.buf = nil
+	if err := w.startImplicit(h); err != nil {
+		return err
+	}
+	if len(buf) == 0 {
+		return nil
+	}
+	_, err := w.Write(buf)
+	return err
+}
+
+// Finish completes a response written with Write: a buffered body is sent
+// with its Content-Length and a chunked one is terminated. It does nothing
+// for responses written with WriteBody or WriteChunkedBody, or once the
+// response is aborted.
+func (w *Writer) Finish() error {
+	if !w.implicit || w.aborted {
+		return nil
+	}
+	switch w.writerState {
+	case writerStateStatusLine, writerStateHeaders:
+		h := w.Header()
+		if h.Get("content-length") == "" && h.Get("transfer-encoding") == "" {
+			h.Set("Content-Length", strconv.Itoa(len(w.buf)))
+		}
+		buf := w.buf
+		w.buf = nil
+		if err := w.startImplicit(h); err != nil {
+			return err
+		}
+		// Header() may have asked for chunked encoding even though the
+		// body fit in the buffer.
+		if w.writerState == writerStateChunkedBody {
+			if _, err := w.WriteChunkedBody(buf); err != nil {
+				return err
+			}
+			if _, err := w.WriteChunkedBodyDone(); err != nil {
+				return err
+			}
+		} else if _, err := w.WriteBody(buf); err != nil {
+			return err
+		}
+	case writerStateChunkedBody:
+		if _, err := w.WriteChunkedBodyDone(); err != nil {
+			return err
+		}
+	}
+	w.implicit = false
+	return nil
+}
+
+// writeFixedBody sends p as part of a body whose headers were written
+// explicitly without chunking. The response is done once the declared
+// Content-Length has been sent; writing past it fails.
+func (w *Writer) writeFixedBody(p []byte) (int, error) {
+	contentLength, err := strconv.Atoi(w.Headers.Get("content-length"))
+	if err == nil && w.bodyWritten+len(p) > contentLength {
+		return 0, &ErrorBodyTooLong{ContentLength: contentLength}
+	}
+	if !w.omitBody && len(p) > 0 {
+		if _, err := w.writer.Write(p); err != nil {
+			return 0, &ErrorWritingBody{Err: err}
+		}
+	}
+	w.bodyWritten += len(p)
+	if err == nil && w.bodyWritten == contentLength {
+		w.writerState = writerStateDone
+	}
+	return len(p), nil
+}
+
+// startImplicit writes whatever of the status line and headers Write has
+// deferred.
+func (w *Writer) startImplicit(h *headers.Headers) error {
+	if w.writerState == writerStateStatusLine {
+		if err := w.WriteStatusLine(StatusOK); err != nil {
+			return err
+		}
+		// WriteStatusLine resets implicit mode, but here the response
+		// being started is the implicit one.
+		w.implicit = true
+	}
+	if h.Get("content-type") == "" {
+		h.Set("Content-Type", "text/plain")
+	}
+	return w.WriteHeaders(h)
+}
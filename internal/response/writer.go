@@ -3,41 +3,176 @@ package response
 import (
 	"fmt"
 	"io"
-	"net"
+	"strconv"
 
 	"github.com/DimRev/httpfromtcp/internal/headers"
 )
 
 type Writer struct {
 	StatusLine []byte
-	Headers    headers.Headers
+	Headers    *headers.Headers
 	Body       []byte
 
-	writerState writerState
-	writer      io.Writer
+	writerState    writerState
+	writer         io.Writer
+	statusCode     StatusCode
+	headerHooks    []func(*headers.Headers)
+	httpVersion    string
+	keepAlive      bool
+	omitBody       bool
+	closeDelimited bool
+	aborted        bool
+
+	// Used by Write, which buffers the body until it outgrows bufferSize.
+	header     *headers.Headers
+	buf        []byte
+	bufferSize int
+	implicit   bool
+
+	// bodyWritten counts the body bytes sent, to check them against the
+	// declared Content-Length.
+	bodyWritten int
 }
 
+// DefaultBufferSize is how much of a body Write buffers to send it with a
+// Content-Length before switching to chunked encoding.
+const DefaultBufferSize = 4096
+
 type writerState int
 
+// A response moves from the status line to the headers and then to either
+// a single WriteBody or a run of chunks, depending on whether the headers
+// ask for chunked encoding. Writes out of order fail with
+// ErrorInvalidWriterState.
 const (
 	writerStateStatusLine writerState = iota
 	writerStateHeaders
 	writerStateBody
+	writerStateChunkedBody
 	writerStateDone
 )
 
-func NewWriter(conn net.Conn) *Writer {
+func (s writerState) String() string {
+	switch s {
+	case writerStateStatusLine:
+		return "status line"
+	case writerStateHeaders:
+		return "headers"
+	case writerStateBody:
+		return "body"
+	case writerStateChunkedBody:
+		return "chunked body"
+	case writerStateDone:
+		return "done"
+	}
+	return fmt.Sprintf("writerState(%d)", int(s))
+}
+
+func NewWriter(conn io.Writer) *Writer {
 	return &Writer{
 		writerState: writerStateStatusLine,
 		writer:      conn,
+		httpVersion: "1.1",
+		bufferSize:  DefaultBufferSize,
+	}
+}
+
+// Reset discards all state, including settings and hooks, so the writer can
+// answer another request on conn as if it were new.
+func (w *Writer) Reset(conn io.Writer) {
+	buf := w.buf[:0]
+	*w = *NewWriter(conn)
+	w.buf = buf
+}
+
+// SetHttpVersion sets the version written in the status line, which should
+// match the request being answered. HTTP/1.0 clients do not understand
+// chunked encoding, so chunked responses to them are sent close-delimited.
+func (w *Writer) SetHttpVersion(httpVersion string) {
+	w.httpVersion = httpVersion
+}
+
+// SetKeepAlive tells the writer whether the connection may be reused after
+// this response. When it may not, WriteHeaders adds "Connection: close";
+// when it may and the client speaks HTTP/1.0, it adds "Connection: keep-alive".
+func (w *Writer) SetKeepAlive(keepAlive bool) {
+	w.keepAlive = keepAlive
+}
+
+// SetOmitBody makes the writer accept body writes without sending them, as
+// required when answering a HEAD request.
+func (w *Writer) SetOmitBody(omitBody bool) {
+	w.omitBody = omitBody
+}
+
+// OnWriteHeaders registers hook to run on the response headers just before
+// they are written, letting middleware add fields to any response.
+func (w *Writer) OnWriteHeaders(hook func(*headers.Headers)) {
+	w.headerHooks = append(w.headerHooks, hook)
+}
+
+// StatusCode returns the status written so far, or 0 before WriteStatusLine.
+func (w *Writer) StatusCode() StatusCode {
+	return w.statusCode
+}
+
+// Started reports whether any part of the response has been written.
+func (w *Writer) Started() bool {
+	return w.writerState != writerStateStatusLine
+}
+
+// Abort marks a response that cannot be completed, as after a handler
+// panics mid-body. The connection is not reused and Finish leaves the
+// response unterminated, so the client sees it truncated.
+func (w *Writer) Abort() {
+	w.aborted = true
+	w.keepAlive = false
+}
+
+// KeepAlive reports whether the connection can carry another request once
+// the handler returns: keep-alive must be allowed, the response must not ask
+// to close, and it must be complete, its body exactly as long as its
+// Content-Length or ended by a terminating chunk. A response to HEAD is complete once its headers
+// are written.
+func (w *Writer) KeepAlive() bool {
+	if !w.keepAlive || w.Headers == nil {
+		return false
+	}
+	if w.Headers.ContainsToken("connection", "close") {
+		return false
 	}
+	if w.omitBody {
+		return true
+	}
+	if w.writerState != writerStateDone {
+		return false
+	}
+	if w.Headers.ContainsToken("transfer-encoding", "chunked") {
+		return true
+	}
+	contentLength, err := strconv.Atoi(w.Headers.Get("content-length"))
+	return err == nil && w.bodyWritten == contentLength
 }
 
 func (w *Writer) WriteStatusLine(statusCode StatusCode) error {
+	return w.WriteStatusLineWithReason(statusCode, StatusText(statusCode))
+}
+
+// WriteStatusLineWithReason writes the status line with a custom reason
+// phrase in place of the registered one.
+func (w *Writer) WriteStatusLineWithReason(statusCode StatusCode, reasonPhrase string) error {
 	if w.writerState != writerStateStatusLine {
 		return &ErrorInvalidWriterState{CurrentState: w.writerState, ExpectedState: writerStateStatusLine}
 	}
-	w.StatusLine = getStatusLine(statusCode)
+	if err := checkStatusLine(statusCode, reasonPhrase); err != nil {
+		return err
+	}
+	// Nothing has been sent yet, so a body buffered by Write is dropped in
+	// favour of the response being started explicitly.
+	w.buf = nil
+	w.implicit = false
+	w.statusCode = statusCode
+	w.StatusLine = getStatusLine(w.httpVersion, statusCode, reasonPhrase)
 	_, err := w.writer.Write(w.StatusLine)
 	if err != nil {
 		return &ErrorWritingStatusLine{Err: err}
@@ -45,40 +180,77 @@ func (w *Writer) WriteStatusLine(statusCode StatusCode) error {
 	w.writerState = writerStateHeaders
 	return nil
 }
-func (w *Writer) WriteHeaders(headers headers.Headers) error {
+func (w *Writer) WriteHeaders(headers *headers.Headers) error {
 	if w.writerState != writerStateHeaders {
 		return &ErrorInvalidWriterState{CurrentState: w.writerState, ExpectedState: writerStateHeaders}
 	}
-	w.Headers = headers
-	for key, value := range headers {
-		_, err := w.writer.Write([]byte(fmt.Sprintf("%s: %s\r\n", key, value)))
-		if err != nil {
-			return &ErrorWritingHeaders{Err: err}
+	for _, hook := range w.headerHooks {
+		hook(headers)
+	}
+	chunked := headers.ContainsToken("transfer-encoding", "chunked")
+	if w.httpVersion == "1.0" && headers.ContainsToken("transfer-encoding", "chunked") {
+		headers.Del("Transfer-Encoding")
+		headers.Del("Trailer")
+		headers.Set("Connection", "close")
+		w.keepAlive = false
+		w.closeDelimited = true
+	}
+	if headers.Get("connection") == "" {
+		if !w.keepAlive {
+			headers.Set("Connection", "close")
+		} else if w.httpVersion == "1.0" {
+			headers.Set("Connection", "keep-alive")
 		}
 	}
+	w.Headers = headers
+	if _, err := headers.WriteTo(w.writer); err != nil {
+		return &ErrorWritingHeaders{Err: err}
+	}
 	_, err := w.writer.Write([]byte(CRLF))
 	if err != nil {
 		return &ErrorWritingHeaders{Err: err}
 	}
-	w.writerState = writerStateBody
+	if chunked {
+		w.writerState = writerStateChunkedBody
+	} else {
+		w.writerState = writerStateBody
+	}
 	return nil
 }
 func (w *Writer) WriteBody(p []byte) (int, error) {
 	if w.writerState != writerStateBody {
 		return 0, &ErrorInvalidWriterState{CurrentState: w.writerState, ExpectedState: writerStateBody}
 	}
+	contentLength, err := strconv.Atoi(w.Headers.Get("content-length"))
+	if err == nil && w.bodyWritten+len(p) > contentLength {
+		return 0, &ErrorBodyTooLong{ContentLength: contentLength}
+	}
 	w.Body = p
-	_, err := w.writer.Write(p)
-	if err != nil {
-		return 0, &ErrorWritingBody{Err: err}
+	if !w.omitBody {
+		_, err := w.writer.Write(p)
+		if err != nil {
+			return 0, &ErrorWritingBody{Err: err}
+		}
 	}
+	w.bodyWritten += len(p)
 	w.writerState = writerStateDone
 	return len(p), nil
 }
 
 func (w *Writer) WriteChunkedBody(p []byte) (int, error) {
-	if w.writerState != writerStateBody {
-		return 0, &ErrorInvalidWriterState{CurrentState: w.writerState, ExpectedState: writerStateBody}
+	if w.writerState != writerStateChunkedBody {
+		return 0, &ErrorInvalidWriterState{CurrentState: w.writerState, ExpectedState: writerStateChunkedBody}
+	}
+	// An empty chunk would read as the last-chunk and end the body early.
+	if len(p) == 0 || w.omitBody {
+		return len(p), nil
+	}
+	if w.closeDelimited {
+		n, err := w.writer.Write(p)
+		if err != nil {
+			return n, &ErrorWritingChunkedBody{Err: err}
+		}
+		return n, nil
 	}
 
 	chunkSize := len(p)
@@ -104,12 +276,53 @@ func (w *Writer) WriteChunkedBody(p []byte) (int, error) {
 }
 
 func (w *Writer) WriteChunkedBodyDone() (int, error) {
-	if w.writerState != writerStateBody {
-		return 0, fmt.Errorf("cannot write body in state %d", w.writerState)
+	if w.writerState != writerStateChunkedBody {
+		return 0, &ErrorInvalidWriterState{CurrentState: w.writerState, ExpectedState: writerStateChunkedBody}
+	}
+	w.writerState = writerStateDone
+	if w.omitBody || w.closeDelimited {
+		return 0, nil
 	}
 	n, err := w.writer.Write([]byte("0\r\n\r\n"))
 	if err != nil {
-		return n, err
+		return n, &ErrorWritingChunkedBody{Err: err}
 	}
 	return n, nil
 }
+
+// WriteTrailers ends a chunked body with the terminating chunk followed by
+// trailers, which must each be named in the response's Trailer header. It
+// replaces WriteChunkedBodyDone. Responses to HEAD and HTTP/1.0 requests
+// carry no trailers, so for them nothing is sent.
+func (w *Writer) WriteTrailers(trailers *headers.Headers) error {
+	if w.writerState != writerStateChunkedBody {
+		return &ErrorInvalidWriterState{CurrentState: w.writerState, ExpectedState: writerStateChunkedBody}
+	}
+	if w.closeDelimited {
+		w.writerState = writerStateDone
+		return nil
+	}
+	for key := range trailers.All() {
+		if !w.Headers.ContainsToken("trailer", key) {
+			return &ErrorUndeclaredTrailer{Field: key}
+		}
+	}
+	if w.omitBody {
+		w.writerState = writerStateDone
+		return nil
+	}
+
+	_, err := w.writer.Write([]byte("0\r\n"))
+	if err != nil {
+		return &ErrorWritingTrailers{Err: err}
+	}
+	if _, err := trailers.WriteTo(w.writer); err != nil {
+		return &ErrorWritingTrailers{Err: err}
+	}
+	_, err = w.writer.Write([]byte(CRLF))
+	if err != nil {
+		return &ErrorWritingTrailers{Err: err}
+	}
+	w.writerState = writerStateDone
+	return nil
+}
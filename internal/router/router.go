@@ -0,0 +1,290 @@
+package router
+
+import (
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/DimRev/httpfromtcp/internal/request"
+	"github.com/DimRev/httpfromtcp/internal/response"
+	"github.com/DimRev/httpfromtcp/internal/server"
+)
+
+// Router dispatches requests to handlers by method and path. Patterns are
+// slash-separated segments where "{name}" matches one segment and a final
+// "{name...}" matches the rest of the path. Matched values are available
+// through request.Request.PathValue.
+type Router struct {
+	// NotFound answers requests no route or mount matches. When nil a plain
+	// 404 is written.
+	NotFound server.Handler
+
+	routes []*route
+	mounts []*mount
+}
+
+type route struct {
+	method   string
+	segments []segment
+	handler  server.Handler
+}
+
+type mount struct {
+	prefix  string
+	handler server.Handler
+}
+
+type segmentKind int
+
+const (
+	segmentWildcard segmentKind = iota
+	segmentParam
+	segmentStatic
+)
+
+type segment struct {
+	kind  segmentKind
+	value string
+}
+
+func New() *Router {
+	return &Router{}
+}
+
+// Handle registers handler for method and pattern. An empty method matches
+// every method. It panics if pattern is malformed.
+func (r *Router) Handle(method, pattern string, handler server.Handler) {
+	r.routes = append(r.routes, &route{
+		method:   method,
+		segments: parsePattern(pattern),
+		handler:  handler,
+	})
+}
+
+func (r *Router) Any(pattern string, handler server.Handler) {
+	r.Handle("", pattern, handler)
+}
+
+func (r *Router) Get(pattern string, handler server.Handler) {
+	r.Handle(request.MethodGet, pattern, handler)
+}
+
+func (r *Router) Post(pattern string, handler server.Handler) {
+	r.Handle(request.MethodPost, pattern, handler)
+}
+
+func (r *Router) Put(pattern string, handler server.Handler) {
+	r.Handle(request.MethodPut, pattern, handler)
+}
+
+func (r *Router) Patch(pattern string, handler server.Handler) {
+	r.Handle(request.MethodPatch, pattern, handler)
+}
+
+func (r *Router) Delete(pattern string, handler server.Handler) {
+	r.Handle(request.MethodDelete, pattern, handler)
+}
+
+// Mount sends every request under prefix to handler, with prefix removed
+// from the request path. Routes take precedence over mounts, and longer
+// prefixes over shorter ones.
+func (r *Router) Mount(prefix string, handler server.Handler) {
+	r.mounts = append(r.mounts, &mount{
+		prefix:  strings.TrimSuffix(prefix, "/"),
+		handler: handler,
+	})
+}
+
+// Serve is a server.Handler. Methods that are neither standard nor served
+// by any route get a 501 unless a mount takes the request.
+func (r *Router) Serve(w *response.Writer, req *request.Request) {
+	pathSegments := strings.Split(strings.TrimPrefix(req.Target.RawPath, "/"), "/")
+
+	var best *route
+	var bestValues map[string]string
+	var allowed []string
+	for _, rt := range r.routes {
+		values, ok := rt.match(pathSegments)
+		if !ok {
+			continue
+		}
+		if !rt.allows(req.RequestLine.Method) {
+			allowed = append(allowed, rt.methods()...)
+			continue
+		}
+		if best == nil || rt.moreSpecificThan(best) {
+			best, bestValues = rt, values
+		}
+	}
+
+	if best != nil {
+		for name, value := range bestValues {
+			req.SetPathValue(name, value)
+		}
+		best.handler(w, req)
+		return
+	}
+	m := r.findMount(req.Target.RawPath)
+	if m == nil && !r.recognizes(req.RequestLine.Method) {
+		writeText(w, response.StatusNotImplemented, "method not implemented: "+req.RequestLine.Method)
+		return
+	}
+	if len(allowed) > 0 {
+		methodNotAllowed(w, allowed)
+		return
+	}
+	if m != nil {
+		m.handler(w, stripPrefix(req, m.prefix))
+		return
+	}
+	if r.NotFound != nil {
+		r.NotFound(w, req)
+		return
+	}
+	writeText(w, response.StatusNotFound, "not found")
+}
+
+// recognizes reports whether method is standard or served by some route,
+// so a request that matches nothing is a 404 or 405 rather than a 501.
+func (r *Router) recognizes(method string) bool {
+	if request.IsStandardMethod(method) {
+		return true
+	}
+	return slices.ContainsFunc(r.routes, func(rt *route) bool {
+		return rt.method == method
+	})
+}
+
+func (r *Router) findMount(rawPath string) *mount {
+	var best *mount
+	for _, m := range r.mounts {
+		if rawPath != m.prefix && !strings.HasPrefix(rawPath, m.prefix+"/") {
+			continue
+		}
+		if best == nil || len(m.prefix) > len(best.prefix) {
+			best = m
+		}
+	}
+	return best
+}
+
+func (rt *route) match(pathSegments []string) (map[string]string, bool) {
+	values := map[string]string{}
+	for i, seg := range rt.segments {
+		if seg.kind == segmentWildcard {
+			rest, err := url.PathUnescape(strings.Join(pathSegments[i:], "/"))
+			if err != nil {
+				return nil, false
+			}
+			values[seg.value] = rest
+			return values, true
+		}
+		if i >= len(pathSegments) {
+			return nil, false
+		}
+		value, err := url.PathUnescape(pathSegments[i])
+		if err != nil {
+			return nil, false
+		}
+		switch seg.kind {
+		case segmentStatic:
+			if value != seg.value {
+				return nil, false
+			}
+		case segmentParam:
+			if value == "" {
+				return nil, false
+			}
+			values[seg.value] = value
+		}
+	}
+	if len(pathSegments) != len(rt.segments) {
+		return nil, false
+	}
+	return values, true
+}
+
+// allows reports whether the route serves method. GET routes also answer
+// HEAD, whose body the server discards.
+func (rt *route) allows(method string) bool {
+	return rt.method == "" || rt.method == method ||
+		(rt.method == request.MethodGet && method == request.MethodHead)
+}
+
+func (rt *route) methods() []string {
+	if rt.method == request.MethodGet {
+		return []string{request.MethodGet, request.MethodHead}
+	}
+	return []string{rt.method}
+}
+
+// moreSpecificThan prefers static segments over parameters and parameters
+// over wildcards, comparing from the start of the path.
+func (rt *route) moreSpecificThan(other *route) bool {
+	for i := 0; i < len(rt.segments) && i < len(other.segments); i++ {
+		if rt.segments[i].kind != other.segments[i].kind {
+			return rt.segments[i].kind > other.segments[i].kind
+		}
+	}
+	return len(rt.segments) > len(other.segments)
+}
+
+func parsePattern(pattern string) []segment {
+	if !strings.HasPrefix(pattern, "/") {
+		panic("router: pattern must begin with '/': " + pattern)
+	}
+	parts := strings.Split(pattern[1:], "/")
+	segments := make([]segment, 0, len(parts))
+	for i, part := range parts {
+		if !strings.HasPrefix(part, "{") || !strings.HasSuffix(part, "}") {
+			segments = append(segments, segment{kind: segmentStatic, value: part})
+			continue
+		}
+		name := part[1 : len(part)-1]
+		kind := segmentParam
+		if strings.HasSuffix(name, "...") {
+			if i != len(parts)-1 {
+				panic("router: wildcard must be the last segment: " + pattern)
+			}
+			name = strings.TrimSuffix(name, "...")
+			kind = segmentWildcard
+		}
+		if name == "" {
+			panic("router: empty parameter name: " + pattern)
+		}
+		segments = append(segments, segment{kind: kind, value: name})
+	}
+	return segments
+}
+
+// stripPrefix returns a shallow copy of req whose path has prefix removed.
+func stripPrefix(req *request.Request, prefix string) *request.Request {
+	stripped := *req
+	stripped.Target.RawPath = strings.TrimPrefix(req.Target.RawPath, prefix)
+	if stripped.Target.RawPath == "" {
+		stripped.Target.RawPath = "/"
+	}
+	if path, err := url.PathUnescape(stripped.Target.RawPath); err == nil {
+		stripped.Target.Path = path
+	}
+	return &stripped
+}
+
+func methodNotAllowed(w *response.Writer, allowed []string) {
+	sort.Strings(allowed)
+	allowed = slices.Compact(allowed)
+
+	message := "method not allowed"
+	h := response.GetDefaultHeaders(len(message))
+	h.Set("Allow", strings.Join(allowed, ", "))
+	w.WriteStatusLine(response.StatusMethodNotAllowed)
+	w.WriteHeaders(h)
+	w.WriteBody([]byte(message))
+}
+
+func writeText(w *response.Writer, statusCode response.StatusCode, message string) {
+	w.WriteStatusLine(statusCode)
+	w.WriteHeaders(response.GetDefaultHeaders(len(message)))
+	w.WriteBody([]byte(message))
+}
@@ -0,0 +1,133 @@
+package router
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/DimRev/httpfromtcp/internal/request"
+	"github.com/DimRev/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serve runs a request through the router and returns the raw response.
+func serve(t *testing.T, r *Router, method, target string) string {
+	t.Helper()
+	raw := method + " " + target + " HTTP/1.1\r\nHost: localhost:42069\r\n\r\n"
+	req, err := request.RequestFromReader(strings.NewReader(raw))
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	r.Serve(response.NewWriter(&buf), req)
+	return buf.String()
+}
+
+// reply writes body with a 200 status.
+func reply(body string) func(w *response.Writer, req *request.Request) {
+	return func(w *response.Writer, req *request.Request) {
+		w.WriteStatusLine(response.StatusOK)
+		w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+		w.WriteBody([]byte(body))
+	}
+}
+
+// echoPathValue replies with the named path value.
+func echoPathValue(name string) func(w *response.Writer, req *request.Request) {
+	return func(w *response.Writer, req *request.Request) {
+		reply(req.PathValue(name))(w, req)
+	}
+}
+
+func TestRouter(t *testing.T) {
+	t.Run("static routes by method", func(t *testing.T) {
+		r := New()
+		r.Get("/users", reply("list"))
+		r.Post("/users", reply("create"))
+
+		assert.True(t, strings.HasSuffix(serve(t, r, "GET", "/users"), "list"))
+		assert.True(t, strings.HasSuffix(serve(t, r, "POST", "/users"), "create"))
+	})
+
+	t.Run("path parameters", func(t *testing.T) {
+		r := New()
+		r.Get("/users/{id}", echoPathValue("id"))
+
+		resp := serve(t, r, "GET", "/users/a%2Fb")
+		assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 200 OK"))
+		assert.True(t, strings.HasSuffix(resp, "a/b"))
+
+		resp = serve(t, r, "GET", "/users/")
+		assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 404 Not Found"))
+	})
+
+	t.Run("wildcards", func(t *testing.T) {
+		r := New()
+		r.Get("/files/{path...}", echoPathValue("path"))
+
+		assert.True(t, strings.HasSuffix(serve(t, r, "GET", "/files/a/b/c.txt"), "a/b/c.txt"))
+		assert.True(t, strings.HasPrefix(serve(t, r, "GET", "/files"), "HTTP/1.1 200 OK"))
+	})
+
+	t.Run("most specific route wins", func(t *testing.T) {
+		r := New()
+		r.Get("/{path...}", reply("wildcard"))
+		r.Get("/users/{id}", reply("param"))
+		r.Get("/users/me", reply("static"))
+
+		assert.True(t, strings.HasSuffix(serve(t, r, "GET", "/users/me"), "static"))
+		assert.True(t, strings.HasSuffix(serve(t, r, "GET", "/users/42"), "param"))
+		assert.True(t, strings.HasSuffix(serve(t, r, "GET", "/other"), "wildcard"))
+	})
+
+	t.Run("method not allowed", func(t *testing.T) {
+		r := New()
+		r.Get("/users", reply("list"))
+		r.Post("/users", reply("create"))
+
+		resp := serve(t, r, "DELETE", "/users")
+		assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 405 Method Not Allowed"))
+		assert.Contains(t, resp, "Allow: GET, HEAD, POST\r\n")
+	})
+
+	t.Run("extension methods", func(t *testing.T) {
+		r := New()
+		r.Get("/users", reply("list"))
+		r.Handle("PROPFIND", "/dav", reply("props"))
+
+		resp := serve(t, r, "BREW", "/users")
+		assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 501 Not Implemented"))
+		assert.True(t, strings.HasSuffix(serve(t, r, "PROPFIND", "/dav"), "props"))
+		resp = serve(t, r, "PROPFIND", "/users")
+		assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 405 Method Not Allowed"))
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		r := New()
+		r.Get("/users", reply("list"))
+		assert.True(t, strings.HasPrefix(serve(t, r, "GET", "/nope"), "HTTP/1.1 404 Not Found"))
+
+		r.NotFound = reply("custom")
+		assert.True(t, strings.HasSuffix(serve(t, r, "GET", "/nope"), "custom"))
+	})
+
+	t.Run("mounts", func(t *testing.T) {
+		api := New()
+		api.Get("/users/{id}", echoPathValue("id"))
+
+		r := New()
+		r.Get("/api/health", reply("ok"))
+		r.Mount("/api", api.Serve)
+
+		assert.True(t, strings.HasSuffix(serve(t, r, "GET", "/api/health"), "ok"))
+		assert.True(t, strings.HasSuffix(serve(t, r, "GET", "/api/users/7"), "7"))
+		assert.True(t, strings.HasPrefix(serve(t, r, "GET", "/apiary"), "HTTP/1.1 404 Not Found"))
+	})
+
+	t.Run("malformed patterns", func(t *testing.T) {
+		r := New()
+		assert.Panics(t, func() { r.Get("users", reply("")) })
+		assert.Panics(t, func() { r.Get("/{rest...}/more", reply("")) })
+		assert.Panics(t, func() { r.Get("/{}", reply("")) })
+	})
+}
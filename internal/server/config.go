@@ -0,0 +1,73 @@
+package server
+
+import (
+	"crypto/tls"
+	"time"
+
+	"github.com/DimRev/httpfromtcp/internal/headers"
+	"github.com/DimRev/httpfromtcp/internal/request"
+)
+
+// Config tunes how the server treats its connections. A zero timeout
+// disables that timeout.
+type Config struct {
+	// ReadHeaderTimeout bounds reading the request line and headers. Clients
+	// that are too slow are answered with 408 Request Timeout.
+	ReadHeaderTimeout time.Duration
+	// ReadTimeout bounds reading a whole request, body included, measured
+	// from the start of the request.
+	ReadTimeout time.Duration
+	// WriteTimeout bounds writing each response, measured from the end of
+	// reading its headers.
+	WriteTimeout time.Duration
+	// IdleTimeout bounds how long a persistent connection may sit between
+	// requests before it is closed.
+	IdleTimeout time.Duration
+	// HandlerTimeout sets a deadline on each request's context, measured
+	// from when the handler is called.
+	HandlerTimeout time.Duration
+	// Limits caps the size of each request.
+	Limits request.Limits
+	// ObsFold selects whether request header lines folded onto several
+	// lines are rejected with a 400 or joined with spaces.
+	ObsFold headers.ObsFold
+
+	// MaxConns caps how many connections are open at once; 0 means no cap.
+	MaxConns int
+	// QueueWhenFull makes the server stop accepting while at MaxConns, so new
+	// connections wait in the listen backlog, instead of answering them with
+	// 503 Service Unavailable.
+	QueueWhenFull bool
+	// MaxConnsPerClient caps connections from a single client IP; excess
+	// connections are answered with 503. 0 means no cap.
+	MaxConnsPerClient int
+	// RetryAfter is advertised in the Retry-After field of 503 responses.
+	RetryAfter time.Duration
+
+	// TLS, when set, makes the server terminate TLS on every connection.
+	// ServeTLS fills it in from certificate files.
+	TLS *tls.Config
+	// CertReloadInterval is how often ServeTLS checks its certificate files
+	// for changes. 0 disables reloading.
+	CertReloadInterval time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		ReadHeaderTimeout: 10 * time.Second,
+		IdleTimeout:       120 * time.Second,
+		Limits:            request.DefaultLimits(),
+		RetryAfter:        5 * time.Second,
+
+		CertReloadInterval: 10 * time.Second,
+	}
+}
+
+// deadline returns the time timeout after start, or the zero time, which
+// clears a deadline, when timeout is disabled.
+func deadline(start time.Time, timeout time.Duration) time.Time {
+	if timeout <= 0 {
+		return time.Time{}
+	}
+	return start.Add(timeout)
+}
@@ -3,11 +3,16 @@ package server
 import "fmt"
 
 type ErrorServerListener struct {
-	Err error
+	Addr string
+	Err  error
 }
 
 func (e *ErrorServerListener) Error() string {
-	return fmt.Sprintf("error: listening on port: %s", e.Err.Error())
+	return fmt.Sprintf("error: listening on %s: %s", e.Addr, e.Err.Error())
+}
+
+func (e *ErrorServerListener) Unwrap() error {
+	return e.Err
 }
 
 type ErrorServerAlreadyClosed struct{}
@@ -23,3 +28,35 @@ type ErrorServerClose struct {
 func (e *ErrorServerClose) Error() string {
 	return fmt.Sprintf("error: closing server: %s", e.Err.Error())
 }
+
+type ErrorServerShutdownForced struct {
+	Connections int
+	Err         error
+}
+
+func (e *ErrorServerShutdownForced) Error() string {
+	return fmt.Sprintf("error: shutdown cut off %d connections: %s", e.Connections, e.Err.Error())
+}
+
+func (e *ErrorServerShutdownForced) Unwrap() error {
+	return e.Err
+}
+
+type ErrorNoCertificates struct{}
+
+func (e *ErrorNoCertificates) Error() string {
+	return "error: no certificates configured"
+}
+
+type ErrorLoadingCertificate struct {
+	CertFile string
+	Err      error
+}
+
+func (e *ErrorLoadingCertificate) Error() string {
+	return fmt.Sprintf("error: loading certificate %s: %s", e.CertFile, e.Err.Error())
+}
+
+func (e *ErrorLoadingCertificate) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"math"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/DimRev/httpfromtcp/internal/response"
+)
+
+// rejectWriteTimeout bounds writing a 503 to a connection turned away;
+// lingeringClose then bounds the rest.
+const rejectWriteTimeout = time.Second
+
+// waitForSlot blocks until the server is below Config.MaxConns, returning
+// false if the server closes first. Connections arriving meanwhile wait in
+// the listen backlog.
+func (s *Server) waitForSlot() bool {
+	if s.slots == nil {
+		return true
+	}
+	select {
+	case s.slots <- struct{}{}:
+		return true
+	case <-s.done:
+		return false
+	}
+}
+
+// tryAcquireSlot takes a connection slot if one is free.
+func (s *Server) tryAcquireSlot() bool {
+	if s.slots == nil {
+		return true
+	}
+	select {
+	case s.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *Server) releaseSlot() {
+	if s.slots != nil {
+		<-s.slots
+	}
+}
+
+// acquireClientSlot counts conn against its client IP, failing if that
+// client already holds Config.MaxConnsPerClient connections.
+func (s *Server) acquireClientSlot(conn net.Conn) bool {
+	if s.config.MaxConnsPerClient <= 0 {
+		return true
+	}
+	ip := clientIP(conn)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.clientConns[ip] >= s.config.MaxConnsPerClient {
+		return false
+	}
+	s.clientConns[ip]++
+	return true
+}
+
+func (s *Server) releaseClientSlot(conn net.Conn) {
+	if s.config.MaxConnsPerClient <= 0 {
+		return
+	}
+	ip := clientIP(conn)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clientConns[ip]--
+	if s.clientConns[ip] <= 0 {
+		delete(s.clientConns, ip)
+	}
+}
+
+// clientIP identifies the client for per-client limits. Connections without
+// an IP address, such as Unix socket peers, share the key of their address.
+func clientIP(conn net.Conn) string {
+	if conn.RemoteAddr() == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return conn.RemoteAddr().String()
+	}
+	return host
+}
+
+// reject answers conn with 503 Service Unavailable without parsing the
+// request, then closes it with lingeringClose so whatever the client already
+// sent does not reset the connection before the 503 is read.
+func (s *Server) reject(conn net.Conn, message string) {
+	defer conn.Close()
+	defer lingeringClose(conn)
+	conn.SetWriteDeadline(time.Now().Add(rejectWriteTimeout))
+
+	w := response.NewWriter(conn)
+	h := response.GetDefaultHeaders(len(message))
+	if s.config.RetryAfter > 0 {
+		h.Set("Retry-After", strconv.Itoa(int(math.Ceil(s.config.RetryAfter.Seconds()))))
+	}
+	w.WriteStatusLine(response.StatusServiceUnavailable)
+	w.WriteHeaders(h)
+	w.WriteBody([]byte(message))
+}
@@ -0,0 +1,15 @@
+package server
+
+// Middleware wraps a Handler with behaviour that runs around it.
+type Middleware func(Handler) Handler
+
+// Chain composes middlewares so the first one listed is the outermost:
+// Chain(a, b)(h) handles a request as a(b(h)).
+func Chain(middlewares ...Middleware) Middleware {
+	return func(handler Handler) Handler {
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			handler = middlewares[i](handler)
+		}
+		return handler
+	}
+}
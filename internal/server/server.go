@@ -1,10 +1,18 @@
 package server
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
+	"runtime/debug"
+	"strings"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/DimRev/httpfromtcp/internal/request"
 	"github.com/DimRev/httpfromtcp/internal/response"
@@ -14,57 +22,495 @@ type Handler func(w *response.Writer, req *request.Request)
 
 type Server struct {
 	handler  Handler
+	config   Config
 	listener net.Listener
 	closed   atomic.Bool
+	done     chan struct{}
+	// slots holds a token per open connection when Config.MaxConns is set.
+	slots chan struct{}
+
+	// baseCtx is the parent of every request context; cancelling it reaches
+	// all handlers still running.
+	baseCtx    context.Context
+	cancelBase context.CancelFunc
+
+	mu          sync.Mutex
+	conns       map[net.Conn]connState
+	clientConns map[string]int
 }
 
-func Serve(port int, handler Handler) (*Server, error) {
-	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+type connState int
+
+const (
+	connStateIdle connState = iota
+	connStateActive
+)
+
+// Serve listens on addr and serves handler with the default config. addr is
+// a TCP "host:port", or "unix:" followed by the path of a Unix domain socket.
+func Serve(addr string, handler Handler) (*Server, error) {
+	return ServeWithConfig(addr, handler, DefaultConfig())
+}
+
+func ServeWithConfig(addr string, handler Handler, config Config) (*Server, error) {
+	listener, err := listen(addr)
 	if err != nil {
-		return nil, err
+		return nil, &ErrorServerListener{Addr: addr, Err: err}
 	}
-	s := &Server{
-		handler:  handler,
-		listener: listener,
+	return ServeListenerWithConfig(listener, handler, config), nil
+}
+
+// ServeListener serves handler on connections accepted from listener, which
+// the server closes when it is closed.
+func ServeListener(listener net.Listener, handler Handler) *Server {
+	return ServeListenerWithConfig(listener, handler, DefaultConfig())
+}
+
+func ServeListenerWithConfig(listener net.Listener, handler Handler, config Config) *Server {
+	if config.TLS != nil {
+		listener = tls.NewListener(listener, config.TLS)
 	}
+	s := NewServer(handler, config)
+	s.listener = listener
 	go s.listen()
+	return s
+}
+
+// NewServer returns a server that does not accept connections itself; hand
+// it connections with ServeConn.
+func NewServer(handler Handler, config Config) *Server {
+	s := &Server{
+		handler: handler,
+		config:  config,
+		done:    make(chan struct{}),
+		conns:   map[net.Conn]connState{},
+
+		clientConns: map[string]int{},
+	}
+	if config.MaxConns > 0 {
+		s.slots = make(chan struct{}, config.MaxConns)
+	}
+	s.baseCtx, s.cancelBase = context.WithCancel(context.Background())
+	return s
+}
+
+func listen(addr string) (net.Listener, error) {
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		return net.Listen("unix", path)
+	}
+	return net.Listen("tcp", addr)
+}
+
+// ServeTLS serves HTTPS using the given certificate files, choosing between
+// them by SNI. Settings already in config.TLS, such as client certificate
+// verification, are kept. The files are checked for changes every
+// config.CertReloadInterval and reloaded without a restart.
+func ServeTLS(addr string, handler Handler, config Config, certs ...CertificateFiles) (*Server, error) {
+	store, err := NewCertStore(certs...)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if config.TLS != nil {
+		tlsConfig = config.TLS.Clone()
+	}
+	tlsConfig.GetCertificate = store.GetCertificate
+	config.TLS = tlsConfig
+
+	s, err := ServeWithConfig(addr, handler, config)
+	if err != nil {
+		return nil, err
+	}
+	if config.CertReloadInterval > 0 {
+		go store.watch(config.CertReloadInterval, s.done)
+	}
 	return s, nil
 }
 
+// Addr returns the address the server is listening on, or nil for a server
+// created with NewServer.
+func (s *Server) Addr() net.Addr {
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
+}
+
+// ServeConn serves requests on a connection accepted elsewhere and returns
+// once it is closed. The connection counts toward the server's connection
+// limits and is drained by Shutdown like any other.
+func (s *Server) ServeConn(conn net.Conn) {
+	if s.closed.Load() {
+		conn.Close()
+		return
+	}
+	if s.config.TLS != nil {
+		if _, ok := conn.(*tls.Conn); !ok {
+			conn = tls.Server(conn, s.config.TLS)
+		}
+	}
+	if !s.tryAcquireSlot() {
+		s.reject(conn, "server at connection limit")
+		return
+	}
+	s.admit(conn)
+}
+
+// Close stops accepting connections and cancels the context of every
+// request still being handled. Use Shutdown to let them finish first.
 func (s *Server) Close() error {
-	s.closed.Store(true)
+	s.markClosed()
+	s.cancelBase()
 	if s.listener != nil {
 		return s.listener.Close()
 	}
 	return nil
 }
 
+// Shutdown stops accepting connections, closes idle ones and lets active
+// ones finish their current response before closing. If ctx ends first the
+// remaining requests have their contexts cancelled, their connections are
+// closed immediately and an ErrorServerShutdownForced reports how many were
+// cut off.
+func (s *Server) Shutdown(ctx context.Context) error {
+	if !s.markClosed() {
+		return &ErrorServerAlreadyClosed{}
+	}
+	if s.listener != nil {
+		if err := s.listener.Close(); err != nil {
+			return &ErrorServerClose{Err: err}
+		}
+	}
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for {
+		if s.closeIdleConns() == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			s.cancelBase()
+			return &ErrorServerShutdownForced{Connections: s.closeAllConns(), Err: ctx.Err()}
+		case <-ticker.C:
+		}
+	}
+}
+
+const shutdownPollInterval = 10 * time.Millisecond
+
+// markClosed flags the server as closed, returning false if it already was.
+func (s *Server) markClosed() bool {
+	if s.closed.Swap(true) {
+		return false
+	}
+	close(s.done)
+	return true
+}
+
+// closeIdleConns closes connections waiting for a request and returns how
+// many connections remain open.
+func (s *Server) closeIdleConns() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn, state := range s.conns {
+		if state == connStateIdle {
+			conn.Close()
+			delete(s.conns, conn)
+		}
+	}
+	return len(s.conns)
+}
+
+func (s *Server) closeAllConns() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := len(s.conns)
+	for conn := range s.conns {
+		conn.Close()
+		delete(s.conns, conn)
+	}
+	return n
+}
+
+// setConnState records whether conn is waiting for a request or serving
+// one. Marking a connection active fails once the server is shutting down.
+func (s *Server) setConnState(conn net.Conn, state connState) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if state == connStateActive && s.closed.Load() {
+		return false
+	}
+	s.conns[conn] = state
+	return true
+}
+
+func (s *Server) forgetConn(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.conns, conn)
+}
+
 func (s *Server) listen() {
 	for {
+		if s.config.QueueWhenFull && !s.waitForSlot() {
+			return
+		}
 		conn, err := s.listener.Accept()
 		if err != nil {
+			if s.config.QueueWhenFull {
+				s.releaseSlot()
+			}
 			if s.closed.Load() {
 				return
 			}
 			log.Printf("Error accepting connection: %v", err)
 			continue
 		}
-		go s.handle(conn)
+		if !s.config.QueueWhenFull && !s.tryAcquireSlot() {
+			go s.reject(conn, "server at connection limit")
+			continue
+		}
+		go s.admit(conn)
 	}
 }
 
+// admit serves conn once it holds a connection slot, first checking the
+// per-client limit.
+func (s *Server) admit(conn net.Conn) {
+	if !s.acquireClientSlot(conn) {
+		s.releaseSlot()
+		s.reject(conn, "too many connections from client")
+		return
+	}
+	s.setConnState(conn, connStateIdle)
+	s.handle(conn)
+}
+
 func (s *Server) handle(conn net.Conn) {
+	defer s.releaseSlot()
+	defer s.releaseClientSlot(conn)
 	defer conn.Close()
+	defer s.forgetConn(conn)
+
+	connCtx, cancelConn := context.WithCancel(s.baseCtx)
+	defer cancelConn()
 
+	reader := request.NewReader(conn)
+	reader.StreamBody = true
+	reader.Limits = s.config.Limits
+	reader.ObsFold = s.config.ObsFold
 	w := response.NewWriter(conn)
-	req, err := request.RequestFromReader(conn)
-	if err != nil {
-		fmt.Printf("Error parsing request:\n- %v\n", err)
-		w.WriteStatusLine(response.StatusBadRequest)
-		w.WriteHeaders(response.GetDefaultHeaders(len(err.Error())))
-		w.WriteBody([]byte(err.Error()))
-		return
+	for first := true; ; first = false {
+		waitTimeout := s.config.IdleTimeout
+		if first {
+			waitTimeout = s.config.ReadHeaderTimeout
+		}
+		conn.SetReadDeadline(deadline(time.Now(), waitTimeout))
+		if err := reader.WaitForRequest(); err != nil {
+			return
+		}
+		if !s.setConnState(conn, connStateActive) {
+			return
+		}
+
+		start := time.Now()
+		conn.SetReadDeadline(deadline(start, s.config.ReadHeaderTimeout))
+		req, err := reader.ReadRequest()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return
+			}
+			conn.SetWriteDeadline(deadline(time.Now(), s.config.WriteTimeout))
+			if isTimeout(err) {
+				writeError(response.NewWriter(conn), response.StatusRequestTimeout, "request timeout")
+				return
+			}
+			fmt.Printf("Error parsing request:\n- %v\n", err)
+			writeError(response.NewWriter(conn), statusForParseError(err), err.Error())
+			lingeringClose(conn)
+			return
+		}
+		conn.SetReadDeadline(deadline(start, s.config.ReadTimeout))
+		conn.SetWriteDeadline(deadline(time.Now(), s.config.WriteTimeout))
+		if tlsConn, ok := conn.(*tls.Conn); ok {
+			state := tlsConn.ConnectionState()
+			req.TLS = &state
+		}
+
+		w.Reset(conn)
+		w.SetHttpVersion(req.RequestLine.HttpVersion)
+		w.SetKeepAlive(!s.closed.Load() && wantsKeepAlive(req))
+		w.SetOmitBody(req.RequestLine.Method == request.MethodHead)
+		ctx, cancel := s.requestContext(connCtx)
+		stopWatching := watchDisconnect(conn, reader, cancelConn)
+		s.callHandler(w, req.WithContext(ctx))
+		stopWatching()
+		cancel()
+
+		// Only a response the handler finished leaves the connection in a
+		// state where another can follow.
+		if !w.KeepAlive() || s.closed.Load() {
+			if !reader.BodyConsumed() {
+				lingeringClose(conn)
+			}
+			return
+		}
+		if err := req.BodyReader.Close(); err != nil {
+			lingeringClose(conn)
+			return
+		}
+		s.setConnState(conn, connStateIdle)
 	}
+}
 
+// wantsKeepAlive reports whether the client is willing to send another
+// request on the same connection. HTTP/1.1 connections persist unless the
+// client sends "Connection: close"; HTTP/1.0 ones only persist when the
+// client asks for "Connection: keep-alive".
+func wantsKeepAlive(req *request.Request) bool {
+	if req.RequestLine.HttpVersion == "1.0" {
+		return req.Headers.ContainsToken("connection", "keep-alive")
+	}
+	return !req.Headers.ContainsToken("connection", "close")
+}
+
+func (s *Server) requestContext(connCtx context.Context) (context.Context, context.CancelFunc) {
+	if s.config.HandlerTimeout > 0 {
+		return context.WithTimeout(connCtx, s.config.HandlerTimeout)
+	}
+	return context.WithCancel(connCtx)
+}
+
+// watchDisconnect cancels the connection context if the client goes away
+// while the handler runs. Until the request body has been consumed the
+// handler owns reads from the connection, so only requests whose body is
+// already read are watched. The returned func stops watching and must be
+// called before the connection is read from again; bytes of a pipelined
+// request read while watching stay buffered in reader.
+func watchDisconnect(conn net.Conn, reader *request.Reader, cancel context.CancelFunc) func() {
+	if !reader.BodyConsumed() {
+		return func() {}
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		err := reader.WaitForRequest()
+		if err != nil && !isTimeout(err) {
+			cancel()
+		}
+	}()
+	return func() {
+		conn.SetReadDeadline(aLongTimeAgo)
+		<-done
+	}
+}
+
+// aLongTimeAgo is a deadline in the past, used to unblock pending reads.
+var aLongTimeAgo = time.Unix(1, 0)
+
+// callHandler runs the handler, recovering from a panic with HandlePanic so
+// it only costs the connection it happened on. A streamed body that turned
+// out to be malformed or too large is answered like a header error when the
+// handler has not started a response; otherwise a response the handler wrote
+// with Write is finished once it returns, and a handler that wrote nothing
+// answers with an empty 200.
+func (s *Server) callHandler(w *response.Writer, req *request.Request) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			HandlePanic(w, req, rec)
+		}
+	}()
 	s.handler(w, req)
+	if err := req.BodyError(); err != nil && !w.Started() && !isReadError(err) {
+		w.SetKeepAlive(false)
+		writeError(w, statusForParseError(err), err.Error())
+		return
+	}
+	if !w.Started() {
+		w.Write(nil)
+	}
+	if err := w.Finish(); err != nil {
+		log.Printf("Error finishing response: %v", err)
+	}
+}
+
+// HandlePanic logs a value recovered from a handler and answers with a 500
+// if nothing was written yet. Otherwise the response is aborted and the
+// connection closed, so the client sees a truncated response rather than a
+// corrupted or falsely complete one.
+func HandlePanic(w *response.Writer, req *request.Request, rec any) {
+	log.Printf("Panic handling %s %s: %v\n%s",
+		req.RequestLine.Method,
+		req.RequestLine.RequestTarget,
+		rec,
+		debug.Stack(),
+	)
+	if w.Started() {
+		w.Abort()
+		return
+	}
+	w.SetKeepAlive(false)
+	writeError(w, response.StatusInternalServerError, "internal server error")
+}
+
+func writeError(w *response.Writer, statusCode response.StatusCode, message string) {
+	w.WriteStatusLine(statusCode)
+	w.WriteHeaders(response.GetDefaultHeaders(len(message)))
+	w.WriteBody([]byte(message))
+}
+
+// lingerTimeout and lingerMaxBytes bound how long and how much
+// lingeringClose reads before giving up.
+const (
+	lingerTimeout  = 500 * time.Millisecond
+	lingerMaxBytes = 256 << 10
+)
+
+// lingeringClose half-closes conn and discards what the client is still
+// sending for a moment. Closing with unread input would reset the connection
+// and could destroy the error response before the client reads it.
+func lingeringClose(conn net.Conn) {
+	if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+		cw.CloseWrite()
+	}
+	conn.SetReadDeadline(time.Now().Add(lingerTimeout))
+	io.CopyN(io.Discard, conn, lingerMaxBytes)
+}
+
+// statusForParseError picks the response status for a request that could
+// not be parsed.
+func statusForParseError(err error) response.StatusCode {
+	var errRequestLineTooLong *request.ErrorParsingRequestLineTooLong
+	var errHeadersTooLarge *request.ErrorParsingHeadersTooLarge
+	var errHeadersTooMany *request.ErrorParsingHeadersTooMany
+	var errBodyTooLarge *request.ErrorParsingBodyTooLarge
+	var errUnsupportedVersion *request.ErrorParsingRequestUnsupportedVersion
+	var errUnsupportedCoding *request.ErrorParsingRequestUnsupportedTransferCoding
+	switch {
+	case errors.As(err, &errUnsupportedVersion):
+		return response.StatusHTTPVersionNotSupported
+	case errors.As(err, &errUnsupportedCoding):
+		return response.StatusNotImplemented
+	case errors.As(err, &errRequestLineTooLong):
+		return response.StatusURITooLong
+	case errors.As(err, &errHeadersTooLarge), errors.As(err, &errHeadersTooMany):
+		return response.StatusRequestHeaderFieldsTooLarge
+	case errors.As(err, &errBodyTooLarge):
+		return response.StatusContentTooLarge
+	default:
+		return response.StatusBadRequest
+	}
+}
+
+// isReadError reports whether err came from reading the connection rather
+// than from what the client sent.
+func isReadError(err error) bool {
+	var errRead *request.ErrorUnexpectedReadError
+	return errors.As(err, &errRead)
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
 }
@@ -0,0 +1,768 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DimRev/httpfromtcp/internal/request"
+	"github.com/DimRev/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startServer serves handler on a free port and returns a connected client.
+func startServer(t *testing.T, handler Handler) net.Conn {
+	t.Helper()
+	return startServerWithConfig(t, handler, DefaultConfig())
+}
+
+func startServerWithConfig(t *testing.T, handler Handler, config Config) net.Conn {
+	t.Helper()
+	s, err := ServeWithConfig("127.0.0.1:0", handler, config)
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+
+	conn, err := net.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func echoTarget(w *response.Writer, req *request.Request) {
+	body := req.Target.Path
+	w.WriteStatusLine(response.StatusOK)
+	w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+	w.WriteBody([]byte(body))
+}
+
+// readResponse reads one Content-Length delimited response from r.
+func readResponse(t *testing.T, r *bufio.Reader) (statusLine string, body string) {
+	t.Helper()
+	statusLine, err := r.ReadString('\n')
+	require.NoError(t, err)
+	contentLength := 0
+	for {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		if line == "\r\n" {
+			break
+		}
+		key, value, _ := strings.Cut(line, ":")
+		if strings.EqualFold(key, "content-length") {
+			contentLength, err = strconv.Atoi(strings.TrimSpace(value))
+			require.NoError(t, err)
+		}
+	}
+	buf := make([]byte, contentLength)
+	_, err = io.ReadFull(r, buf)
+	require.NoError(t, err)
+	return strings.TrimSpace(statusLine), string(buf)
+}
+
+func TestServerKeepAlive(t *testing.T) {
+	t.Run("persists until the client closes", func(t *testing.T) {
+		conn := startServer(t, echoTarget)
+		reader := bufio.NewReader(conn)
+
+		for _, target := range []string{"/one", "/two"} {
+			_, err := conn.Write([]byte("GET " + target + " HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+			require.NoError(t, err)
+			statusLine, body := readResponse(t, reader)
+			assert.Equal(t, "HTTP/1.1 200 OK", statusLine)
+			assert.Equal(t, target, body)
+		}
+
+		_, err := conn.Write([]byte("GET /three HTTP/1.1\r\nConnection: close\r\n\r\n"))
+		require.NoError(t, err)
+		_, body := readResponse(t, reader)
+		assert.Equal(t, "/three", body)
+		_, err = reader.ReadByte()
+		assert.ErrorIs(t, err, io.EOF)
+	})
+
+	t.Run("honors keep-alive among connection options", func(t *testing.T) {
+		conn := startServer(t, echoTarget)
+		reader := bufio.NewReader(conn)
+
+		for _, target := range []string{"/one", "/two"} {
+			_, err := conn.Write([]byte("GET " + target + " HTTP/1.1\r\nConnection: Keep-Alive, Upgrade\r\n\r\n"))
+			require.NoError(t, err)
+			_, body := readResponse(t, reader)
+			assert.Equal(t, target, body)
+		}
+	})
+
+	t.Run("closes when the handler asks", func(t *testing.T) {
+		conn := startServer(t, func(w *response.Writer, req *request.Request) {
+			h := response.GetDefaultHeaders(2)
+			h.Set("Connection", "close")
+			w.WriteStatusLine(response.StatusOK)
+			w.WriteHeaders(h)
+			w.WriteBody([]byte("ok"))
+		})
+
+		_, err := conn.Write([]byte("GET / HTTP/1.1\r\n\r\nGET / HTTP/1.1\r\n\r\n"))
+		require.NoError(t, err)
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		resp, err := io.ReadAll(conn)
+		require.NoError(t, err, "connection should be closed after the response")
+		assert.Equal(t, 1, strings.Count(string(resp), "HTTP/1.1 "))
+	})
+}
+
+func TestServerPipelining(t *testing.T) {
+	t.Run("responses follow request order", func(t *testing.T) {
+		conn := startServer(t, func(w *response.Writer, req *request.Request) {
+			if req.Target.Path == "/slow" {
+				time.Sleep(20 * time.Millisecond)
+			}
+			echoTarget(w, req)
+		})
+		reader := bufio.NewReader(conn)
+
+		_, err := conn.Write([]byte(
+			"GET /slow HTTP/1.1\r\n\r\n" +
+				"POST /two HTTP/1.1\r\nContent-Length: 3\r\n\r\nabc" +
+				"GET /three HTTP/1.1\r\n\r\n",
+		))
+		require.NoError(t, err)
+		for _, target := range []string{"/slow", "/two", "/three"} {
+			_, body := readResponse(t, reader)
+			assert.Equal(t, target, body)
+		}
+	})
+
+	t.Run("bodies are consumed before the next request", func(t *testing.T) {
+		conn := startServer(t, func(w *response.Writer, req *request.Request) {
+			if req.Target.Path == "/skip" {
+				echoTarget(w, req)
+				return
+			}
+			body, err := io.ReadAll(req.BodyReader)
+			require.NoError(t, err)
+			w.WriteStatusLine(response.StatusOK)
+			w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+			w.WriteBody(body)
+		})
+		reader := bufio.NewReader(conn)
+
+		_, err := conn.Write([]byte(
+			"POST /read HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n3\r\nabc\r\n0\r\n\r\n" +
+				"POST /skip HTTP/1.1\r\nContent-Length: 5\r\n\r\nGET /" +
+				"POST /read HTTP/1.1\r\nContent-Length: 3\r\n\r\ndef",
+		))
+		require.NoError(t, err)
+		for _, want := range []string{"abc", "/skip", "def"} {
+			_, body := readResponse(t, reader)
+			assert.Equal(t, want, body)
+		}
+	})
+}
+
+func TestServerHead(t *testing.T) {
+	conn := startServer(t, echoTarget)
+	reader := bufio.NewReader(conn)
+
+	_, err := conn.Write([]byte("HEAD /page HTTP/1.1\r\n\r\nGET /next HTTP/1.1\r\n\r\n"))
+	require.NoError(t, err)
+
+	statusLine, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n", statusLine)
+	var head []string
+	for {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		if line == "\r\n" {
+			break
+		}
+		head = append(head, line)
+	}
+	assert.Contains(t, head, "Content-Length: 5\r\n")
+
+	// The next bytes must start the GET response, not the HEAD body.
+	statusLine, body := readResponse(t, reader)
+	assert.Equal(t, "HTTP/1.1 200 OK", statusLine)
+	assert.Equal(t, "/next", body)
+}
+
+func TestServerHTTP10(t *testing.T) {
+	t.Run("closes without keep-alive", func(t *testing.T) {
+		conn := startServer(t, echoTarget)
+
+		_, err := conn.Write([]byte("GET /old HTTP/1.0\r\n\r\n"))
+		require.NoError(t, err)
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		resp, err := io.ReadAll(conn)
+		require.NoError(t, err, "connection should be closed after the response")
+		assert.True(t, strings.HasPrefix(string(resp), "HTTP/1.0 200 OK\r\n"))
+		assert.Contains(t, string(resp), "Connection: close\r\n")
+		assert.True(t, strings.HasSuffix(string(resp), "/old"))
+	})
+
+	t.Run("persists with keep-alive", func(t *testing.T) {
+		conn := startServer(t, echoTarget)
+		reader := bufio.NewReader(conn)
+
+		for _, target := range []string{"/one", "/two"} {
+			_, err := conn.Write([]byte("GET " + target + " HTTP/1.0\r\nConnection: keep-alive\r\n\r\n"))
+			require.NoError(t, err)
+			statusLine, body := readResponse(t, reader)
+			assert.Equal(t, "HTTP/1.0 200 OK", statusLine)
+			assert.Equal(t, target, body)
+		}
+	})
+
+	t.Run("streams close-delimited bodies", func(t *testing.T) {
+		conn := startServer(t, func(w *response.Writer, req *request.Request) {
+			w.SetBufferSize(1)
+			io.WriteString(w, "streamed")
+		})
+
+		_, err := conn.Write([]byte("GET / HTTP/1.0\r\nConnection: keep-alive\r\n\r\n"))
+		require.NoError(t, err)
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		resp, err := io.ReadAll(conn)
+		require.NoError(t, err, "connection should be closed to end the body")
+		assert.NotContains(t, string(resp), "Transfer-Encoding")
+		assert.True(t, strings.HasSuffix(string(resp), "\r\n\r\nstreamed"))
+	})
+
+	t.Run("other major versions get 505", func(t *testing.T) {
+		conn := startServer(t, echoTarget)
+
+		_, err := conn.Write([]byte("GET / HTTP/2.0\r\n\r\n"))
+		require.NoError(t, err)
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		resp, err := io.ReadAll(conn)
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(string(resp), "HTTP/1.1 505 HTTP Version Not Supported\r\n"))
+	})
+}
+
+func TestServerPanicRecovery(t *testing.T) {
+	t.Run("before writing", func(t *testing.T) {
+		conn := startServer(t, func(w *response.Writer, req *request.Request) {
+			panic("boom")
+		})
+		reader := bufio.NewReader(conn)
+
+		_, err := conn.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+		require.NoError(t, err)
+		statusLine, _ := readResponse(t, reader)
+		assert.Equal(t, "HTTP/1.1 500 Internal Server Error", statusLine)
+		_, err = reader.ReadByte()
+		assert.ErrorIs(t, err, io.EOF)
+	})
+
+	t.Run("mid-body", func(t *testing.T) {
+		conn := startServer(t, func(w *response.Writer, req *request.Request) {
+			w.WriteStatusLine(response.StatusOK)
+			h := response.GetDefaultHeaders(0)
+			h.Del("Content-Length")
+			h.Set("Transfer-Encoding", "chunked")
+			w.WriteHeaders(h)
+			w.WriteChunkedBody([]byte("partial"))
+			panic("boom")
+		})
+
+		_, err := conn.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+		require.NoError(t, err)
+		data, err := io.ReadAll(conn)
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(string(data), "HTTP/1.1 200 OK"))
+		assert.True(t, strings.HasSuffix(string(data), "7\r\npartial\r\n"))
+	})
+}
+
+func TestServerTimeouts(t *testing.T) {
+	t.Run("slow headers get 408", func(t *testing.T) {
+		config := DefaultConfig()
+		config.ReadHeaderTimeout = 50 * time.Millisecond
+		conn := startServerWithConfig(t, echoTarget, config)
+
+		_, err := conn.Write([]byte("GET / HTTP/1.1\r\nHost: loc"))
+		require.NoError(t, err)
+		data, err := io.ReadAll(conn)
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(string(data), "HTTP/1.1 408 Request Timeout"))
+	})
+
+	t.Run("idle connection closed", func(t *testing.T) {
+		config := DefaultConfig()
+		config.IdleTimeout = 50 * time.Millisecond
+		conn := startServerWithConfig(t, echoTarget, config)
+		reader := bufio.NewReader(conn)
+
+		_, err := conn.Write([]byte("GET /one HTTP/1.1\r\n\r\n"))
+		require.NoError(t, err)
+		_, body := readResponse(t, reader)
+		assert.Equal(t, "/one", body)
+
+		start := time.Now()
+		_, err = reader.ReadByte()
+		assert.ErrorIs(t, err, io.EOF)
+		assert.Less(t, time.Since(start), time.Second)
+	})
+
+	t.Run("idle wait does not count against header timeout", func(t *testing.T) {
+		config := DefaultConfig()
+		config.ReadHeaderTimeout = 100 * time.Millisecond
+		conn := startServerWithConfig(t, echoTarget, config)
+		reader := bufio.NewReader(conn)
+
+		_, err := conn.Write([]byte("GET /one HTTP/1.1\r\n\r\n"))
+		require.NoError(t, err)
+		readResponse(t, reader)
+
+		time.Sleep(150 * time.Millisecond)
+		_, err = conn.Write([]byte("GET /two HTTP/1.1\r\n\r\n"))
+		require.NoError(t, err)
+		statusLine, body := readResponse(t, reader)
+		assert.Equal(t, "HTTP/1.1 200 OK", statusLine)
+		assert.Equal(t, "/two", body)
+	})
+}
+
+func TestServerShutdown(t *testing.T) {
+	// serve starts handler and returns the server with one connected client.
+	serve := func(t *testing.T, handler Handler) (*Server, net.Conn) {
+		t.Helper()
+		s, err := Serve("127.0.0.1:0", handler)
+		require.NoError(t, err)
+		conn, err := net.Dial("tcp", s.Addr().String())
+		require.NoError(t, err)
+		t.Cleanup(func() { conn.Close() })
+		return s, conn
+	}
+
+	t.Run("waits for in-flight response", func(t *testing.T) {
+		started := make(chan struct{})
+		s, conn := serve(t, func(w *response.Writer, req *request.Request) {
+			close(started)
+			time.Sleep(100 * time.Millisecond)
+			echoTarget(w, req)
+		})
+
+		_, err := conn.Write([]byte("GET /slow HTTP/1.1\r\n\r\n"))
+		require.NoError(t, err)
+		<-started
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		require.NoError(t, s.Shutdown(ctx))
+
+		reader := bufio.NewReader(conn)
+		_, body := readResponse(t, reader)
+		assert.Equal(t, "/slow", body)
+		_, err = reader.ReadByte()
+		assert.ErrorIs(t, err, io.EOF)
+	})
+
+	t.Run("closes idle connections", func(t *testing.T) {
+		s, conn := serve(t, echoTarget)
+		reader := bufio.NewReader(conn)
+
+		_, err := conn.Write([]byte("GET /one HTTP/1.1\r\n\r\n"))
+		require.NoError(t, err)
+		readResponse(t, reader)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		require.NoError(t, s.Shutdown(ctx))
+		_, err = reader.ReadByte()
+		assert.Error(t, err)
+	})
+
+	t.Run("force closes after deadline", func(t *testing.T) {
+		started := make(chan struct{})
+		release := make(chan struct{})
+		defer close(release)
+		s, conn := serve(t, func(w *response.Writer, req *request.Request) {
+			close(started)
+			<-release
+		})
+
+		_, err := conn.Write([]byte("GET /stuck HTTP/1.1\r\n\r\n"))
+		require.NoError(t, err)
+		<-started
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		err = s.Shutdown(ctx)
+		var errForced *ErrorServerShutdownForced
+		require.True(t, errors.As(err, &errForced), "Expected forced shutdown, got %v", err)
+		assert.Equal(t, 1, errForced.Connections)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+		_, err = io.ReadAll(conn)
+		require.NoError(t, err)
+	})
+
+	t.Run("stops accepting", func(t *testing.T) {
+		s, _ := serve(t, echoTarget)
+		require.NoError(t, s.Shutdown(context.Background()))
+
+		_, err := net.Dial("tcp", s.Addr().String())
+		assert.Error(t, err)
+
+		var errClosed *ErrorServerAlreadyClosed
+		assert.True(t, errors.As(s.Shutdown(context.Background()), &errClosed))
+	})
+}
+
+func TestServerRequestContext(t *testing.T) {
+	t.Run("cancelled when client disconnects", func(t *testing.T) {
+		cancelled := make(chan error, 1)
+		conn := startServer(t, func(w *response.Writer, req *request.Request) {
+			select {
+			case <-req.Context().Done():
+				cancelled <- req.Context().Err()
+			case <-time.After(time.Second):
+				cancelled <- nil
+			}
+		})
+
+		_, err := conn.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+		require.NoError(t, err)
+		time.Sleep(20 * time.Millisecond)
+		conn.Close()
+		assert.ErrorIs(t, <-cancelled, context.Canceled)
+	})
+
+	t.Run("handler deadline", func(t *testing.T) {
+		config := DefaultConfig()
+		config.HandlerTimeout = 20 * time.Millisecond
+		conn := startServerWithConfig(t, func(w *response.Writer, req *request.Request) {
+			<-req.Context().Done()
+			body := req.Context().Err().Error()
+			w.WriteStatusLine(response.StatusOK)
+			w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+			w.WriteBody([]byte(body))
+		}, config)
+
+		_, err := conn.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+		require.NoError(t, err)
+		_, body := readResponse(t, bufio.NewReader(conn))
+		assert.Equal(t, context.DeadlineExceeded.Error(), body)
+	})
+
+	t.Run("pipelined request survives watching", func(t *testing.T) {
+		conn := startServer(t, func(w *response.Writer, req *request.Request) {
+			time.Sleep(20 * time.Millisecond)
+			require.NoError(t, req.Context().Err())
+			echoTarget(w, req)
+		})
+		reader := bufio.NewReader(conn)
+
+		_, err := conn.Write([]byte("GET /one HTTP/1.1\r\n\r\n"))
+		require.NoError(t, err)
+		time.Sleep(5 * time.Millisecond)
+		_, err = conn.Write([]byte("GET /two HTTP/1.1\r\n\r\n"))
+		require.NoError(t, err)
+
+		for _, target := range []string{"/one", "/two"} {
+			_, body := readResponse(t, reader)
+			assert.Equal(t, target, body)
+		}
+	})
+}
+
+func TestServerConnectionLimits(t *testing.T) {
+	// serve starts a server and returns a dial func for new clients.
+	serve := func(t *testing.T, config Config) func() net.Conn {
+		t.Helper()
+		s, err := ServeWithConfig("127.0.0.1:0", echoTarget, config)
+		require.NoError(t, err)
+		t.Cleanup(func() { s.Close() })
+		return func() net.Conn {
+			conn, err := net.Dial("tcp", s.Addr().String())
+			require.NoError(t, err)
+			t.Cleanup(func() { conn.Close() })
+			return conn
+		}
+	}
+	// roundTrip sends a request on conn and returns the response status line.
+	roundTrip := func(t *testing.T, conn net.Conn) string {
+		t.Helper()
+		_, err := conn.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+		require.NoError(t, err)
+		statusLine, _ := readResponse(t, bufio.NewReader(conn))
+		return statusLine
+	}
+
+	t.Run("rejects when full", func(t *testing.T) {
+		config := DefaultConfig()
+		config.MaxConns = 1
+		config.RetryAfter = 1500 * time.Millisecond
+		dial := serve(t, config)
+
+		first := dial()
+		assert.Equal(t, "HTTP/1.1 200 OK", roundTrip(t, first))
+
+		data, err := io.ReadAll(dial())
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(string(data), "HTTP/1.1 503 Service Unavailable"))
+		assert.Contains(t, strings.ToLower(string(data)), "retry-after: 2\r\n")
+
+		first.Close()
+		time.Sleep(20 * time.Millisecond)
+		assert.Equal(t, "HTTP/1.1 200 OK", roundTrip(t, dial()))
+	})
+
+	t.Run("rejection survives unread input", func(t *testing.T) {
+		config := DefaultConfig()
+		config.MaxConns = 1
+		dial := serve(t, config)
+
+		first := dial()
+		assert.Equal(t, "HTTP/1.1 200 OK", roundTrip(t, first))
+
+		second := dial()
+		_, err := second.Write([]byte("POST / HTTP/1.1\r\nContent-Length: 4096\r\n\r\n" + strings.Repeat("a", 4096)))
+		require.NoError(t, err)
+		second.SetReadDeadline(time.Now().Add(time.Second))
+		data, err := io.ReadAll(second)
+		require.NoError(t, err, "connection should be closed, not reset")
+		assert.True(t, strings.HasPrefix(string(data), "HTTP/1.1 503 Service Unavailable"))
+	})
+
+	t.Run("queues when full", func(t *testing.T) {
+		config := DefaultConfig()
+		config.MaxConns = 1
+		config.QueueWhenFull = true
+		dial := serve(t, config)
+
+		first := dial()
+		assert.Equal(t, "HTTP/1.1 200 OK", roundTrip(t, first))
+
+		second := dial()
+		_, err := second.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+		require.NoError(t, err)
+		second.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+		_, err = second.Read(make([]byte, 1))
+		assert.True(t, isTimeout(err), "Expected queued connection to wait, got %v", err)
+
+		first.Close()
+		second.SetReadDeadline(time.Time{})
+		statusLine, _ := readResponse(t, bufio.NewReader(second))
+		assert.Equal(t, "HTTP/1.1 200 OK", statusLine)
+	})
+
+	t.Run("per-client limit", func(t *testing.T) {
+		config := DefaultConfig()
+		config.MaxConnsPerClient = 1
+		dial := serve(t, config)
+
+		first := dial()
+		assert.Equal(t, "HTTP/1.1 200 OK", roundTrip(t, first))
+
+		data, err := io.ReadAll(dial())
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(string(data), "HTTP/1.1 503 Service Unavailable"))
+	})
+}
+
+func TestServerListeners(t *testing.T) {
+	raw := []byte("GET /hello HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+
+	t.Run("bind address", func(t *testing.T) {
+		s, err := Serve("127.0.0.1:0", echoTarget)
+		require.NoError(t, err)
+		t.Cleanup(func() { s.Close() })
+		host, _, err := net.SplitHostPort(s.Addr().String())
+		require.NoError(t, err)
+		assert.Equal(t, "127.0.0.1", host)
+	})
+
+	t.Run("invalid address", func(t *testing.T) {
+		_, err := Serve("not-an-address", echoTarget)
+		var target *ErrorServerListener
+		assert.ErrorAs(t, err, &target)
+	})
+
+	t.Run("unix socket", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "server.sock")
+		s, err := Serve("unix:"+path, echoTarget)
+		require.NoError(t, err)
+		t.Cleanup(func() { s.Close() })
+
+		conn, err := net.Dial("unix", path)
+		require.NoError(t, err)
+		t.Cleanup(func() { conn.Close() })
+		_, err = conn.Write(raw)
+		require.NoError(t, err)
+		statusLine, body := readResponse(t, bufio.NewReader(conn))
+		assert.Equal(t, "HTTP/1.1 200 OK", statusLine)
+		assert.Equal(t, "/hello", body)
+	})
+
+	t.Run("in-memory listener", func(t *testing.T) {
+		listener := NewPipeListener()
+		s := ServeListener(listener, echoTarget)
+		t.Cleanup(func() { s.Close() })
+
+		conn, err := listener.Dial()
+		require.NoError(t, err)
+		t.Cleanup(func() { conn.Close() })
+		go conn.Write(raw)
+		statusLine, body := readResponse(t, bufio.NewReader(conn))
+		assert.Equal(t, "HTTP/1.1 200 OK", statusLine)
+		assert.Equal(t, "/hello", body)
+
+		require.NoError(t, s.Close())
+		_, err = listener.Dial()
+		assert.ErrorIs(t, err, net.ErrClosed)
+	})
+
+	t.Run("single connection", func(t *testing.T) {
+		s := NewServer(echoTarget, DefaultConfig())
+		client, conn := net.Pipe()
+		t.Cleanup(func() { client.Close() })
+
+		served := make(chan struct{})
+		go func() {
+			s.ServeConn(conn)
+			close(served)
+		}()
+		go client.Write(raw)
+		statusLine, body := readResponse(t, bufio.NewReader(client))
+		assert.Equal(t, "HTTP/1.1 200 OK", statusLine)
+		assert.Equal(t, "/hello", body)
+
+		select {
+		case <-served:
+		case <-time.After(time.Second):
+			t.Fatal("ServeConn did not return after the connection closed")
+		}
+		assert.NoError(t, s.Shutdown(context.Background()))
+	})
+}
+
+func TestServerImplicitResponses(t *testing.T) {
+	conn := startServer(t, func(w *response.Writer, req *request.Request) {
+		io.WriteString(w, req.Target.Path)
+	})
+	reader := bufio.NewReader(conn)
+
+	for _, target := range []string{"/one", "/two"} {
+		_, err := conn.Write([]byte("GET " + target + " HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+		require.NoError(t, err)
+		statusLine, body := readResponse(t, reader)
+		assert.Equal(t, "HTTP/1.1 200 OK", statusLine)
+		assert.Equal(t, target, body)
+	}
+}
+
+func TestServerEmptyResponses(t *testing.T) {
+	conn := startServer(t, func(w *response.Writer, req *request.Request) {})
+	reader := bufio.NewReader(conn)
+
+	for range 2 {
+		_, err := conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+		require.NoError(t, err)
+		statusLine, body := readResponse(t, reader)
+		assert.Equal(t, "HTTP/1.1 200 OK", statusLine)
+		assert.Empty(t, body)
+	}
+}
+
+func TestServerUnfinishedResponses(t *testing.T) {
+	conn := startServer(t, func(w *response.Writer, req *request.Request) {
+		h := response.GetDefaultHeaders(0)
+		h.Del("Content-Length")
+		h.Set("Transfer-Encoding", "chunked")
+		w.WriteStatusLine(response.StatusOK)
+		w.WriteHeaders(h)
+		w.WriteChunkedBody([]byte("partial"))
+	})
+
+	_, err := conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	resp, err := io.ReadAll(conn)
+	require.NoError(t, err, "connection should be closed, not kept alive")
+	assert.True(t, strings.HasSuffix(string(resp), "7\r\npartial\r\n"))
+}
+
+func TestServerShortBodies(t *testing.T) {
+	conn := startServer(t, func(w *response.Writer, req *request.Request) {
+		w.WriteStatusLine(response.StatusOK)
+		w.WriteHeaders(response.GetDefaultHeaders(10))
+		w.WriteBody([]byte("hi"))
+	})
+
+	_, err := conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\nGET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	resp, err := io.ReadAll(conn)
+	require.NoError(t, err, "connection should be closed, not kept alive")
+	assert.True(t, strings.HasSuffix(string(resp), "\r\n\r\nhi"))
+	assert.Equal(t, 1, strings.Count(string(resp), "HTTP/1.1 "))
+}
+
+func TestServerRejectsAmbiguousFraming(t *testing.T) {
+	var calls atomic.Int32
+	conn := startServer(t, func(w *response.Writer, req *request.Request) {
+		calls.Add(1)
+		echoTarget(w, req)
+	})
+
+	_, err := conn.Write([]byte("POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 35\r\nTransfer-Encoding: chunked\r\n\r\n" +
+		"0\r\n\r\nGET /smuggled HTTP/1.1\r\nHost: x\r\n\r\n"))
+	require.NoError(t, err)
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	resp, err := io.ReadAll(conn)
+	require.NoError(t, err, "connection should be closed after the rejection")
+	assert.True(t, strings.HasPrefix(string(resp), "HTTP/1.1 400 Bad Request\r\n"))
+	assert.Contains(t, string(resp), "Connection: close\r\n")
+	assert.Equal(t, 1, strings.Count(string(resp), "HTTP/1.1 "))
+	assert.Zero(t, calls.Load())
+}
+
+func TestServerBodyTooLarge(t *testing.T) {
+	config := DefaultConfig()
+	config.Limits.MaxBodyBytes = 4
+	conn := startServerWithConfig(t, func(w *response.Writer, req *request.Request) {
+		if _, err := io.ReadAll(req.BodyReader); err != nil {
+			return
+		}
+		echoTarget(w, req)
+	}, config)
+
+	_, err := conn.Write([]byte("POST / HTTP/1.1\r\nHost: localhost\r\nTransfer-Encoding: chunked\r\n\r\n" +
+		"3\r\nabc\r\n3\r\ndef\r\n0\r\n\r\n"))
+	require.NoError(t, err)
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	resp, err := io.ReadAll(conn)
+	require.NoError(t, err, "connection should be closed after the rejection")
+	assert.True(t, strings.HasPrefix(string(resp), "HTTP/1.1 413 Content Too Large\r\n"))
+	assert.Contains(t, string(resp), "Connection: close\r\n")
+}
+
+func TestServerExtensionMethods(t *testing.T) {
+	conn := startServer(t, func(w *response.Writer, req *request.Request) {
+		body := req.RequestLine.Method
+		w.WriteStatusLine(response.StatusOK)
+		w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+		w.WriteBody([]byte(body))
+	})
+	reader := bufio.NewReader(conn)
+
+	_, err := conn.Write([]byte("PROPFIND / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	statusLine, body := readResponse(t, reader)
+	assert.Equal(t, "HTTP/1.1 200 OK", statusLine)
+	assert.Equal(t, "PROPFIND", body)
+}
@@ -0,0 +1,147 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CertificateFiles names a PEM certificate chain and its private key.
+type CertificateFiles struct {
+	CertFile string
+	KeyFile  string
+}
+
+// CertStore serves certificates loaded from files. It picks a certificate
+// for each connection by SNI server name, falling back to the first one, and
+// reloads the files when they change on disk.
+type CertStore struct {
+	files []CertificateFiles
+
+	mu       sync.RWMutex
+	fallback *tls.Certificate
+	byName   map[string]*tls.Certificate
+	modTimes []time.Time
+}
+
+func NewCertStore(files ...CertificateFiles) (*CertStore, error) {
+	if len(files) == 0 {
+		return nil, &ErrorNoCertificates{}
+	}
+	c := &CertStore{files: files}
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate. An exact name match
+// wins over a wildcard certificate for the parent domain.
+func (c *CertStore) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	name := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if cert, ok := c.byName[name]; ok {
+		return cert, nil
+	}
+	if i := strings.IndexByte(name, '.'); i > 0 {
+		if cert, ok := c.byName["*"+name[i:]]; ok {
+			return cert, nil
+		}
+	}
+	return c.fallback, nil
+}
+
+// Reload reloads the certificates if any of their files changed since they
+// were last loaded. On error the previous certificates stay in use.
+func (c *CertStore) Reload() error {
+	c.mu.RLock()
+	changed := false
+	for i, modTime := range c.modTimes {
+		if !latestModTime(c.files[i]).Equal(modTime) {
+			changed = true
+			break
+		}
+	}
+	c.mu.RUnlock()
+	if !changed {
+		return nil
+	}
+	return c.load()
+}
+
+// watch calls Reload every interval until done is closed.
+func (c *CertStore) watch(interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := c.Reload(); err != nil {
+				log.Printf("Error reloading certificates: %v", err)
+			}
+		}
+	}
+}
+
+func (c *CertStore) load() error {
+	var fallback *tls.Certificate
+	byName := map[string]*tls.Certificate{}
+	modTimes := make([]time.Time, 0, len(c.files))
+
+	for _, files := range c.files {
+		// Stat before reading so a write racing the load is picked up on the
+		// next Reload rather than missed.
+		modTimes = append(modTimes, latestModTime(files))
+		cert, err := tls.LoadX509KeyPair(files.CertFile, files.KeyFile)
+		if err != nil {
+			return &ErrorLoadingCertificate{CertFile: files.CertFile, Err: err}
+		}
+		if cert.Leaf == nil {
+			cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+			if err != nil {
+				return &ErrorLoadingCertificate{CertFile: files.CertFile, Err: err}
+			}
+		}
+		if fallback == nil {
+			fallback = &cert
+		}
+		names := cert.Leaf.DNSNames
+		if len(names) == 0 && cert.Leaf.Subject.CommonName != "" {
+			names = []string{cert.Leaf.Subject.CommonName}
+		}
+		for _, name := range names {
+			name = strings.ToLower(name)
+			if _, exists := byName[name]; !exists {
+				byName[name] = &cert
+			}
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.fallback = fallback
+	c.byName = byName
+	c.modTimes = modTimes
+	return nil
+}
+
+// latestModTime returns the later of the two files' modification times, so
+// a change to either one is noticed. Missing files report the zero time.
+func latestModTime(files CertificateFiles) time.Time {
+	var latest time.Time
+	for _, name := range []string{files.CertFile, files.KeyFile} {
+		info, err := os.Stat(name)
+		if err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest
+}
@@ -0,0 +1,183 @@
+package server
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DimRev/httpfromtcp/internal/request"
+	"github.com/DimRev/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// selfSigned generates a self-signed certificate for commonName and names.
+func selfSigned(t *testing.T, commonName string, names ...string) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     names,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+// writeCertificate writes cert as PEM files named after name in dir.
+func writeCertificate(t *testing.T, dir, name string, cert tls.Certificate) CertificateFiles {
+	t.Helper()
+	keyDER, err := x509.MarshalECPrivateKey(cert.PrivateKey.(*ecdsa.PrivateKey))
+	require.NoError(t, err)
+	files := CertificateFiles{
+		CertFile: filepath.Join(dir, name+".crt"),
+		KeyFile:  filepath.Join(dir, name+".key"),
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	require.NoError(t, os.WriteFile(files.CertFile, certPEM, 0o600))
+	require.NoError(t, os.WriteFile(files.KeyFile, keyPEM, 0o600))
+	return files
+}
+
+func echoTLS(w *response.Writer, req *request.Request) {
+	body := "plain"
+	if req.TLS != nil {
+		body = tls.VersionName(req.TLS.Version)
+		if len(req.TLS.PeerCertificates) > 0 {
+			body += " " + req.TLS.PeerCertificates[0].Subject.CommonName
+		}
+	}
+	w.WriteStatusLine(response.StatusOK)
+	w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+	w.WriteBody([]byte(body))
+}
+
+func TestServeTLS(t *testing.T) {
+	dir := t.TempDir()
+	alpha := writeCertificate(t, dir, "alpha", selfSigned(t, "alpha", "alpha.test"))
+	beta := writeCertificate(t, dir, "beta", selfSigned(t, "beta", "*.beta.test"))
+
+	config := DefaultConfig()
+	config.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	s, err := ServeTLS("127.0.0.1:0", echoTLS, config, alpha, beta)
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+	addr := s.Addr().String()
+
+	dial := func(t *testing.T, clientConfig *tls.Config) *tls.Conn {
+		t.Helper()
+		clientConfig.InsecureSkipVerify = true
+		conn, err := tls.Dial("tcp", addr, clientConfig)
+		require.NoError(t, err)
+		t.Cleanup(func() { conn.Close() })
+		return conn
+	}
+
+	t.Run("selects certificates by SNI", func(t *testing.T) {
+		for serverName, want := range map[string]string{
+			"alpha.test":       "alpha",
+			"www.beta.test":    "beta",
+			"unknown.test":     "alpha",
+			"ALPHA.TEST.":      "alpha",
+			"deep.x.beta.test": "alpha",
+		} {
+			conn := dial(t, &tls.Config{ServerName: serverName})
+			peer := conn.ConnectionState().PeerCertificates[0]
+			assert.Equal(t, want, peer.Subject.CommonName, serverName)
+		}
+	})
+
+	t.Run("exposes TLS state on the request", func(t *testing.T) {
+		conn := dial(t, &tls.Config{MaxVersion: tls.VersionTLS12})
+		_, err := conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n"))
+		require.NoError(t, err)
+		_, body := readResponse(t, bufio.NewReader(conn))
+		assert.Equal(t, "TLS 1.2", body)
+	})
+
+	t.Run("exposes client certificates", func(t *testing.T) {
+		client := selfSigned(t, "client")
+		conn := dial(t, &tls.Config{Certificates: []tls.Certificate{client}})
+		_, err := conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n"))
+		require.NoError(t, err)
+		_, body := readResponse(t, bufio.NewReader(conn))
+		assert.Equal(t, "TLS 1.3 client", body)
+	})
+}
+
+func TestCertStore(t *testing.T) {
+	t.Run("requires a certificate", func(t *testing.T) {
+		_, err := NewCertStore()
+		var target *ErrorNoCertificates
+		assert.ErrorAs(t, err, &target)
+	})
+
+	t.Run("reports unreadable files", func(t *testing.T) {
+		dir := t.TempDir()
+		_, err := NewCertStore(CertificateFiles{
+			CertFile: filepath.Join(dir, "missing.crt"),
+			KeyFile:  filepath.Join(dir, "missing.key"),
+		})
+		var target *ErrorLoadingCertificate
+		require.ErrorAs(t, err, &target)
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+
+	t.Run("reloads changed files", func(t *testing.T) {
+		dir := t.TempDir()
+		files := writeCertificate(t, dir, "site", selfSigned(t, "old", "site.test"))
+		store, err := NewCertStore(files)
+		require.NoError(t, err)
+
+		hello := &tls.ClientHelloInfo{ServerName: "site.test"}
+		cert, err := store.GetCertificate(hello)
+		require.NoError(t, err)
+		assert.Equal(t, "old", cert.Leaf.Subject.CommonName)
+
+		writeCertificate(t, dir, "site", selfSigned(t, "new", "site.test"))
+		future := time.Now().Add(time.Minute)
+		require.NoError(t, os.Chtimes(files.CertFile, future, future))
+		require.NoError(t, store.Reload())
+
+		cert, err = store.GetCertificate(hello)
+		require.NoError(t, err)
+		assert.Equal(t, "new", cert.Leaf.Subject.CommonName)
+	})
+
+	t.Run("keeps certificates when a reload fails", func(t *testing.T) {
+		dir := t.TempDir()
+		files := writeCertificate(t, dir, "site", selfSigned(t, "old", "site.test"))
+		store, err := NewCertStore(files)
+		require.NoError(t, err)
+
+		require.NoError(t, os.WriteFile(files.CertFile, []byte("garbage"), 0o600))
+		future := time.Now().Add(time.Minute)
+		require.NoError(t, os.Chtimes(files.CertFile, future, future))
+		assert.Error(t, store.Reload())
+
+		cert, err := store.GetCertificate(&tls.ClientHelloInfo{ServerName: "site.test"})
+		require.NoError(t, err)
+		assert.Equal(t, "old", cert.Leaf.Subject.CommonName)
+	})
+}